@@ -0,0 +1,473 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+// This file lets patches be applied directly to Go values.  Pointer
+// segments are resolved against structs (honoring json tags the same
+// way encoding/json does), maps, slices, arrays, pointers and
+// interfaces.  Values from the patch are converted to the Go type of
+// the location they are stored in by round tripping them through
+// JSON.
+
+// deepCopy makes a copy of v that shares nothing a patch could
+// reach.  Unexported struct fields are copied shallowly.  Cyclic
+// values cannot be copied, and return an error.
+func deepCopy(v reflect.Value) (reflect.Value, error) {
+	return cycles{}.deepCopy(v)
+}
+
+func (c cycles) deepCopy(v reflect.Value) (reflect.Value, error) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return v, nil
+		}
+		key, err := c.enter(v)
+		if err != nil {
+			return v, err
+		}
+		defer delete(c, key)
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem, err := c.deepCopy(v.Elem())
+		if err != nil {
+			return v, err
+		}
+		res := reflect.New(v.Type().Elem())
+		res.Elem().Set(elem)
+		return res, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, nil
+		}
+		elem, err := c.deepCopy(v.Elem())
+		if err != nil {
+			return v, err
+		}
+		res := reflect.New(v.Type()).Elem()
+		res.Set(elem)
+		return res, nil
+	case reflect.Map:
+		res := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := c.deepCopy(iter.Value())
+			if err != nil {
+				return v, err
+			}
+			res.SetMapIndex(iter.Key(), elem)
+		}
+		return res, nil
+	case reflect.Slice, reflect.Array:
+		var res reflect.Value
+		if v.Kind() == reflect.Slice {
+			res = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		} else {
+			res = reflect.New(v.Type()).Elem()
+		}
+		for i := 0; i < v.Len(); i++ {
+			elem, err := c.deepCopy(v.Index(i))
+			if err != nil {
+				return v, err
+			}
+			res.Index(i).Set(elem)
+		}
+		return res, nil
+	case reflect.Struct:
+		res := reflect.New(v.Type()).Elem()
+		res.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if res.Field(i).CanSet() {
+				elem, err := c.deepCopy(v.Field(i))
+				if err != nil {
+					return v, err
+				}
+				res.Field(i).Set(elem)
+			}
+		}
+		return res, nil
+	default:
+		return v, nil
+	}
+}
+
+// settable returns a settable copy of v.
+func settable(v reflect.Value) reflect.Value {
+	if v.CanSet() {
+		return v
+	}
+	res := reflect.New(v.Type()).Elem()
+	res.Set(v)
+	return res
+}
+
+// mapKey converts segment i of p into a key for map m.
+func (p Pointer) mapKey(m reflect.Value, i int) (reflect.Value, error) {
+	kt := m.Type().Key()
+	seg := string(p[i])
+	switch kt.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(seg).Convert(kt), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(seg, 10, kt.Bits())
+		if err == nil {
+			return reflect.ValueOf(n).Convert(kt), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(seg, 10, kt.Bits())
+		if err == nil {
+			return reflect.ValueOf(n).Convert(kt), nil
+		}
+	}
+	return reflect.Value{}, &PathNotFoundError{newContext(p, i), fmt.Sprintf("%q is not a valid key for %v", seg, m.Type())}
+}
+
+// toGo converts val into a value of type t.
+func (p Pointer) toGo(val interface{}, t reflect.Type) (reflect.Value, error) {
+	if val != nil && reflect.TypeOf(val).AssignableTo(t) {
+		return reflect.ValueOf(val), nil
+	}
+	buf, err := json.Marshal(val)
+	if err == nil {
+		res := reflect.New(t)
+		if err = json.Unmarshal(buf, res.Interface()); err == nil {
+			return res.Elem(), nil
+		}
+	}
+	return reflect.Value{}, &InvalidOpError{newContext(p, len(p)), fmt.Sprintf("Cannot store value in %v: %v", t, err)}
+}
+
+// toJSON converts a Go value into its unmarshalled JSON equivalent.
+func toJSON(v reflect.Value) (interface{}, error) {
+	var res interface{}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	buf, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	err = utils.Unmarshal(buf, &res)
+	return res, err
+}
+
+// rget returns the value segment i onwards of p refers to in v.
+func (p Pointer) rget(v reflect.Value, i int) (reflect.Value, error) {
+	for {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				if i == len(p) {
+					return v, nil
+				}
+				return v, p.notContainer(i)
+			}
+			v = v.Elem()
+		}
+		if i == len(p) {
+			return v, nil
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			key, err := p.mapKey(v, i)
+			if err != nil {
+				return v, err
+			}
+			found := v.MapIndex(key)
+			if !found.IsValid() {
+				return v, p.missing(i)
+			}
+			v = found
+		case reflect.Struct:
+			found, ok := structField(v, string(p[i]), false)
+			if !ok {
+				return v, p.missing(i)
+			}
+			v = found
+		case reflect.Slice, reflect.Array:
+			index, err := p.offset(i, v.Len())
+			if err != nil {
+				return v, err
+			}
+			v = v.Index(index)
+		default:
+			return v, p.notContainer(i)
+		}
+		i++
+	}
+}
+
+// rwalk walks v to the container of the last segment of p, calls fn
+// on it, and stores any changed containers back in their parents.
+// It returns the new value for v.
+func (p Pointer) rwalk(v reflect.Value, i int, fn func(reflect.Value) (reflect.Value, error)) (reflect.Value, error) {
+	v = settable(v)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v, p.notContainer(i)
+		}
+		inner, err := p.rwalk(v.Elem(), i, fn)
+		if err != nil {
+			return v, err
+		}
+		if v.Kind() == reflect.Ptr {
+			v.Elem().Set(inner)
+		} else {
+			v.Set(inner)
+		}
+		return v, nil
+	}
+	if i == len(p)-1 {
+		return fn(v)
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		key, err := p.mapKey(v, i)
+		if err != nil {
+			return v, err
+		}
+		found := v.MapIndex(key)
+		if !found.IsValid() {
+			return v, p.missing(i)
+		}
+		found, err = p.rwalk(found, i+1, fn)
+		if err != nil {
+			return v, err
+		}
+		v.SetMapIndex(key, found)
+	case reflect.Struct:
+		found, ok := structField(v, string(p[i]), true)
+		if !ok {
+			return v, p.missing(i)
+		}
+		res, err := p.rwalk(found, i+1, fn)
+		if err != nil {
+			return v, err
+		}
+		found.Set(res)
+	case reflect.Slice, reflect.Array:
+		index, err := p.offset(i, v.Len())
+		if err != nil {
+			return v, err
+		}
+		res, err := p.rwalk(v.Index(index), i+1, fn)
+		if err != nil {
+			return v, err
+		}
+		v.Index(index).Set(res)
+	default:
+		return v, p.notContainer(i)
+	}
+	return v, nil
+}
+
+// rput stores val at p in v, growing slices and creating map entries
+// as needed.  If mustExist is set, the location must already exist,
+// which gives replace semantics.
+func (p Pointer) rput(v reflect.Value, val interface{}, mustExist bool) (reflect.Value, error) {
+	if len(p) == 0 {
+		return p.toGo(val, v.Type())
+	}
+	last := len(p) - 1
+	return p.rwalk(v, 0, func(c reflect.Value) (reflect.Value, error) {
+		switch c.Kind() {
+		case reflect.Map:
+			key, err := p.mapKey(c, last)
+			if err != nil {
+				return c, err
+			}
+			if mustExist && !c.MapIndex(key).IsValid() {
+				return c, p.missing(last)
+			}
+			newVal, err := p.toGo(val, c.Type().Elem())
+			if err != nil {
+				return c, err
+			}
+			if c.IsNil() {
+				c.Set(reflect.MakeMap(c.Type()))
+			}
+			c.SetMapIndex(key, newVal)
+		case reflect.Struct:
+			field, ok := structField(c, string(p[last]), true)
+			if !ok {
+				return c, p.missing(last)
+			}
+			newVal, err := p.toGo(val, field.Type())
+			if err != nil {
+				return c, err
+			}
+			field.Set(newVal)
+		case reflect.Slice:
+			newVal, err := p.toGo(val, c.Type().Elem())
+			if err != nil {
+				return c, err
+			}
+			if !mustExist && (p[last] == "-" || string(p[last]) == strconv.Itoa(c.Len())) {
+				return reflect.Append(c, newVal), nil
+			}
+			index, err := p.offset(last, c.Len())
+			if err != nil {
+				return c, err
+			}
+			if mustExist {
+				c.Index(index).Set(newVal)
+				return c, nil
+			}
+			res := reflect.MakeSlice(c.Type(), c.Len()+1, c.Len()+1)
+			reflect.Copy(res, c.Slice(0, index))
+			reflect.Copy(res.Slice(index+1, res.Len()), c.Slice(index, c.Len()))
+			res.Index(index).Set(newVal)
+			return res, nil
+		case reflect.Array:
+			if !mustExist {
+				return c, &InvalidOpError{newContext(p, last), fmt.Sprintf("Cannot grow fixed size array %v", c.Type())}
+			}
+			index, err := p.offset(last, c.Len())
+			if err != nil {
+				return c, err
+			}
+			newVal, err := p.toGo(val, c.Type().Elem())
+			if err != nil {
+				return c, err
+			}
+			c.Index(index).Set(newVal)
+		default:
+			return c, p.notContainer(last)
+		}
+		return c, nil
+	})
+}
+
+// rremove removes the value at p in v.  Struct fields cannot be
+// removed, so they are set to their zero value instead.
+func (p Pointer) rremove(v reflect.Value) (reflect.Value, error) {
+	if len(p) == 0 {
+		return v, &InvalidOpError{ErrorContext{Path: p}, "Cannot remove the whole document"}
+	}
+	last := len(p) - 1
+	return p.rwalk(v, 0, func(c reflect.Value) (reflect.Value, error) {
+		switch c.Kind() {
+		case reflect.Map:
+			key, err := p.mapKey(c, last)
+			if err != nil {
+				return c, err
+			}
+			if !c.MapIndex(key).IsValid() {
+				return c, p.missing(last)
+			}
+			c.SetMapIndex(key, reflect.Value{})
+		case reflect.Struct:
+			field, ok := structField(c, string(p[last]), false)
+			if !ok {
+				return c, p.missing(last)
+			}
+			field.Set(reflect.Zero(field.Type()))
+		case reflect.Slice:
+			index, err := p.offset(last, c.Len())
+			if err != nil {
+				return c, err
+			}
+			res := reflect.MakeSlice(c.Type(), c.Len()-1, c.Len()-1)
+			reflect.Copy(res, c.Slice(0, index))
+			reflect.Copy(res.Slice(index, res.Len()), c.Slice(index+1, c.Len()))
+			return res, nil
+		case reflect.Array:
+			return c, &InvalidOpError{newContext(p, last), fmt.Sprintf("Cannot shrink fixed size array %v", c.Type())}
+		default:
+			return c, p.notContainer(last)
+		}
+		return c, nil
+	})
+}
+
+// applyTo performs a single patch operation on a Go value.
+func (o *Operation) applyTo(v reflect.Value) (reflect.Value, error) {
+	switch o.Op {
+	case "test":
+		found, err := o.path.rget(v, 0)
+		if err != nil {
+			return v, err
+		}
+		actual, err := toJSON(found)
+		if err != nil {
+			return v, err
+		}
+		if !Equal(actual, o.Value) {
+			return v, &TestFailedError{newContext(o.path, len(o.path)), o.Value, actual}
+		}
+		return v, nil
+	case "replace":
+		return o.path.rput(v, utils.Clone(o.Value), true)
+	case "add":
+		return o.path.rput(v, utils.Clone(o.Value), false)
+	case "remove":
+		return o.path.rremove(v)
+	case "move", "copy":
+		found, err := o.from.rget(v, 0)
+		if err != nil {
+			return v, err
+		}
+		copied, err := deepCopy(found)
+		if err != nil {
+			return v, err
+		}
+		val := copied.Interface()
+		if o.Op == "move" {
+			if err = o.from.checkMove(o.path); err != nil {
+				return v, err
+			}
+			if v, err = o.from.rremove(v); err != nil {
+				return v, err
+			}
+		}
+		return o.path.rput(v, val, false)
+	default:
+		return v, &InvalidOpError{ErrorContext{Path: o.path}, fmt.Sprintf("Invalid op %v", o.Op)}
+	}
+}
+
+// ApplyTo applies p to an arbitrary Go value instead of a JSON
+// document.  Structs are traversed using the same field names
+// encoding/json would use for them, and values from the patch are
+// converted to the type of the location they are stored in.
+//
+// If v is a non-nil pointer, the value it points to is updated in
+// place and v is returned as result.  Otherwise, a patched copy of v
+// is returned.  Either way, v is left untouched if the patch fails.
+// If err is returned, the returned int is the index of the operation
+// that failed.
+func (p Patch) ApplyTo(v interface{}) (result interface{}, err error, loc int) {
+	if err = p.fixPointers(); err != nil {
+		return nil, err, 0
+	}
+	orig := reflect.ValueOf(v)
+	inPlace := orig.Kind() == reflect.Ptr && !orig.IsNil()
+	work := orig
+	if inPlace {
+		work = orig.Elem()
+	}
+	if !work.IsValid() {
+		return nil, &InvalidOpError{Reason: "Cannot apply a patch to a nil value"}, 0
+	}
+	if work, err = deepCopy(work); err != nil {
+		return nil, err, 0
+	}
+	for i := range p {
+		if work, err = p[i].applyTo(work); err != nil {
+			return nil, withOp(err, p[i], i), i
+		}
+	}
+	if inPlace {
+		orig.Elem().Set(work)
+		return v, nil, 0
+	}
+	return work.Interface(), nil, 0
+}
@@ -0,0 +1,138 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type applyToInner struct {
+	Name  string            `json:"name"`
+	Tags  []string          `json:"tags,omitempty"`
+	Attrs map[string]string `json:"attrs"`
+}
+
+type applyToBase struct {
+	ID int `json:"id"`
+}
+
+type applyToOuter struct {
+	applyToBase
+	Inner   applyToInner           `json:"inner"`
+	Ptr     *applyToInner          `json:"ptr"`
+	List    []applyToInner         `json:"list"`
+	Counts  map[string]int         `json:"counts"`
+	Extra   map[string]interface{} `json:"extra"`
+	Ignored string                 `json:"-"`
+	NoTag   bool
+}
+
+func newApplyToOuter() applyToOuter {
+	return applyToOuter{
+		applyToBase: applyToBase{ID: 1},
+		Inner:       applyToInner{Name: "inner", Tags: []string{"a", "b"}, Attrs: map[string]string{}},
+		Ptr:         &applyToInner{Name: "ptr"},
+		List:        []applyToInner{{Name: "zero"}, {Name: "one"}},
+		Counts:      map[string]int{"x": 1},
+		Extra:       map[string]interface{}{"nested": map[string]interface{}{"v": []interface{}{1.0, 2.0}}},
+		Ignored:     "ignored",
+	}
+}
+
+var applyToTests = []struct {
+	patch string
+	pass  bool
+}{
+	{`[{"op":"test","path":"/id","value":1},{"op":"replace","path":"/id","value":2}]`, true},
+	{`[{"op":"add","path":"/inner/tags/1","value":"c"},{"op":"remove","path":"/inner/tags/0"}]`, true},
+	{`[{"op":"add","path":"/inner/attrs/k","value":"v"}]`, true},
+	{`[{"op":"replace","path":"/ptr/name","value":"changed"}]`, true},
+	{`[{"op":"add","path":"/list/-","value":{"name":"two","tags":["t"]}}]`, true},
+	{`[{"op":"move","from":"/list/0","path":"/list/-"}]`, true},
+	{`[{"op":"add","path":"/list/2","value":{"name":"three"}}]`, true},
+	{`[{"op":"copy","from":"/inner","path":"/list/0"}]`, true},
+	{`[{"op":"copy","from":"/counts/x","path":"/counts/y"},{"op":"remove","path":"/counts/x"}]`, true},
+	{`[{"op":"add","path":"/extra/nested/v/0","value":{"deep":true}}]`, true},
+	{`[{"op":"replace","path":"/NoTag","value":true},{"op":"remove","path":"/ptr"}]`, true},
+	{`[{"op":"test","path":"/list/1","value":{"name":"one","attrs":null}}]`, true},
+	{`[{"op":"replace","path":"/id","value":3},{"op":"test","path":"/id","value":2}]`, false},
+	{`[{"op":"replace","path":"/Ignored","value":"x"}]`, false},
+	{`[{"op":"replace","path":"/id","value":"not a number"}]`, false},
+	{`[{"op":"add","path":"/list/5","value":{}}]`, false},
+	{`[{"op":"remove","path":"/counts/nope"}]`, false},
+}
+
+func TestApplyTo(t *testing.T) {
+	for _, test := range applyToTests {
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			t.Errorf("Failed to make a Patch from `%v`: %v", test.patch, err)
+			continue
+		}
+		// The result must match what applying the patch to the JSON
+		// form of the value would give.
+		val := newApplyToOuter()
+		src, _ := json.Marshal(val)
+		want, jsonErr, _ := patch.Apply(src)
+		_, err, idx := patch.ApplyTo(&val)
+		if !test.pass {
+			if err == nil {
+				t.Errorf("Expected `%v` to fail", test.patch)
+			}
+			if !reflect.DeepEqual(val, newApplyToOuter()) {
+				t.Errorf("Failed patch `%v` modified its target", test.patch)
+			}
+			continue
+		}
+		if err != nil || jsonErr != nil {
+			t.Errorf("Failed to apply `%v` at %d: %v (JSON: %v)", test.patch, idx, err, jsonErr)
+			continue
+		}
+		var wantVal applyToOuter
+		json.Unmarshal(want, &wantVal)
+		got, _ := json.Marshal(val)
+		want, _ = json.Marshal(wantVal)
+		if string(got) != string(want) {
+			t.Errorf("Applying `%v` gave `%v`, expected `%v`", test.patch, string(got), string(want))
+		}
+		if val.Ignored != "ignored" {
+			t.Errorf("Applying `%v` changed an ignored field", test.patch)
+		}
+	}
+}
+
+func TestApplyToCopy(t *testing.T) {
+	patch, _ := NewPatch([]byte(`[{"op":"add","path":"/b","value":[1,2]}]`))
+	src := map[string][]int{"a": {0}}
+	res, err, _ := patch.ApplyTo(src)
+	if err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	if len(src) != 1 {
+		t.Errorf("ApplyTo modified a value passed by value")
+	}
+	if !reflect.DeepEqual(res, map[string][]int{"a": {0}, "b": {1, 2}}) {
+		t.Errorf("ApplyTo returned %#v", res)
+	}
+	var inner applyToInner
+	patch, _ = NewPatch([]byte(`[{"op":"add","path":"/attrs/k","value":"v"}]`))
+	if _, err, _ = patch.ApplyTo(&inner); err != nil || inner.Attrs["k"] != "v" {
+		t.Errorf("Failed to add to a nil map: %v", err)
+	}
+	patch, _ = NewPatch([]byte(`[{"op":"remove","path":"/a/3"}]`))
+	var rangeErr *IndexOutOfRangeError
+	if _, err, _ = patch.ApplyTo(src); !errors.As(err, &rangeErr) {
+		t.Errorf("Expected an IndexOutOfRangeError, got %v", err)
+	}
+}
+
+func TestApplyToCycles(t *testing.T) {
+	patch, _ := NewPatch([]byte(`[{"op":"replace","path":"/Name","value":"c"}]`))
+	for _, v := range cyclicValues() {
+		if _, err, _ := patch.ApplyTo(v); err == nil || !strings.Contains(err.Error(), "encountered a cycle") {
+			t.Errorf("Expected applying to a cyclic %T to fail, got %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Command jsonpatch creates and applies JSON Patches from the command line.
+//
+// Usage:
+//
+//	jsonpatch diff [--paranoid] [--pretest] [--move] base target
+//	jsonpatch apply patch [doc]
+//	jsonpatch merge changes [doc]
+//	jsonpatch get pointer [doc]
+//	jsonpatch set pointer value [doc]
+//	jsonpatch invert patch [base]
+//
+// Any file argument can be - to read from stdin, and leaving off the
+// last file argument also reads it from stdin.  Results are written
+// to stdout as JSON.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	jsonpatch "github.com/VictorLowther/jsonpatch2"
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+const usage = `Usage:
+  jsonpatch diff [--paranoid] [--pretest] [--move] base target
+  jsonpatch apply patch [doc]
+  jsonpatch merge changes [doc]
+  jsonpatch get pointer [doc]
+  jsonpatch set pointer value [doc]
+  jsonpatch invert patch [base]
+
+Any file argument can be - to read from stdin, and leaving off the
+last file argument also reads it from stdin.
+`
+
+var errUsage = errors.New("invalid arguments")
+
+// files reads the contents of names, with a missing last name or a
+// name of - reading from stdin.
+func files(stdin io.Reader, names []string, want int) ([][]byte, error) {
+	if len(names) == want-1 {
+		names = append(names, "-")
+	}
+	if len(names) != want {
+		return nil, errUsage
+	}
+	res := make([][]byte, len(names))
+	usedStdin := false
+	for i, name := range names {
+		var err error
+		if name == "-" {
+			if usedStdin {
+				return nil, fmt.Errorf("stdin can only be read once")
+			}
+			usedStdin = true
+			res[i], err = io.ReadAll(stdin)
+		} else {
+			res[i], err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func output(stdout io.Writer, val interface{}) error {
+	buf, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, buf)
+}
+
+func writeJSON(stdout io.Writer, buf []byte) error {
+	_, err := fmt.Fprintf(stdout, "%s\n", buf)
+	return err
+}
+
+func diff(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	opts := jsonpatch.GenerateOptions{}
+	fs.BoolVar(&opts.Paranoid, "paranoid", false, "test each changed value before changing it")
+	fs.BoolVar(&opts.Pretest, "pretest", false, "test the whole base document first")
+	fs.BoolVar(&opts.MoveAndCopy, "move", false, "generate move and copy ops")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	bufs, err := files(stdin, fs.Args(), 2)
+	if err != nil {
+		return err
+	}
+	patch, err := jsonpatch.GenerateWithOptions(bufs[0], bufs[1], opts)
+	if err != nil {
+		return err
+	}
+	return output(stdout, patch)
+}
+
+func apply(args []string, stdin io.Reader, stdout io.Writer) error {
+	bufs, err := files(stdin, args, 2)
+	if err != nil {
+		return err
+	}
+	patch, err := jsonpatch.NewPatch(bufs[0])
+	if err != nil {
+		return err
+	}
+	res, err, _ := patch.Apply(bufs[1])
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, res)
+}
+
+func merge(args []string, stdin io.Reader, stdout io.Writer) error {
+	bufs, err := files(stdin, args, 2)
+	if err != nil {
+		return err
+	}
+	res, err := utils.MergeJSON(bufs[1], bufs[0])
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, res)
+}
+
+func get(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	ptr, err := jsonpatch.NewPointer(args[0])
+	if err != nil {
+		return err
+	}
+	bufs, err := files(stdin, args[1:], 1)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := utils.Unmarshal(bufs[0], &doc); err != nil {
+		return err
+	}
+	res, err := ptr.Get(doc)
+	if err != nil {
+		return err
+	}
+	return output(stdout, res)
+}
+
+func set(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	ptr, err := jsonpatch.NewPointer(args[0])
+	if err != nil {
+		return err
+	}
+	var val interface{}
+	if err := utils.Unmarshal([]byte(args[1]), &val); err != nil {
+		return fmt.Errorf("value is not valid JSON: %v", err)
+	}
+	bufs, err := files(stdin, args[2:], 1)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := utils.Unmarshal(bufs[0], &doc); err != nil {
+		return err
+	}
+	if len(ptr) == 0 {
+		return output(stdout, val)
+	}
+	// Replace existing values in place, so that setting an array
+	// element does not insert a new one.
+	if _, err = ptr.Get(doc); err == nil {
+		doc, err = ptr.Replace(doc, val)
+	} else {
+		doc, err = ptr.Put(doc, val)
+	}
+	if err != nil {
+		return err
+	}
+	return output(stdout, doc)
+}
+
+func invert(args []string, stdin io.Reader, stdout io.Writer) error {
+	bufs, err := files(stdin, args, 2)
+	if err != nil {
+		return err
+	}
+	patch, err := jsonpatch.NewPatch(bufs[0])
+	if err != nil {
+		return err
+	}
+	res, err, _ := patch.Invert(bufs[1])
+	if err != nil {
+		return err
+	}
+	return output(stdout, res)
+}
+
+var commands = map[string]func([]string, io.Reader, io.Writer) error{
+	"diff":   diff,
+	"apply":  apply,
+	"merge":  merge,
+	"get":    get,
+	"set":    set,
+	"invert": invert,
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return errUsage
+	}
+	return cmd(args[1:], stdin, stdout)
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	switch {
+	case err == errUsage:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "jsonpatch: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	base := write("base.json", `{"a":1,"b":[1,2]}`)
+	target := write("target.json", `{"a":2,"b":[1,2]}`)
+	patch := write("patch.json", `[{"op":"replace","path":"/a","value":2}]`)
+	badPatch := write("bad.json", `[{"op":"test","path":"/a","value":1},{"op":"test","path":"/a","value":3}]`)
+
+	for _, test := range []struct {
+		args   []string
+		stdin  string
+		output string
+		fail   bool
+	}{
+		{[]string{"diff", base, target}, ``, `[{"op":"replace","path":"/a","from":"","value":2}]`, false},
+		{[]string{"diff", "--paranoid", base}, `{"a":2,"b":[1,2]}`, `[{"op":"test","path":"/a","from":"","value":1},{"op":"replace","path":"/a","from":"","value":2}]`, false},
+		{[]string{"apply", patch, base}, ``, `{"a":2,"b":[1,2]}`, false},
+		{[]string{"apply", patch}, `{"a":5}`, `{"a":2}`, false},
+		{[]string{"merge", "-", base}, `{"b":null,"c":3}`, `{"a":1,"c":3}`, false},
+		{[]string{"get", "/b/1", base}, ``, `2`, false},
+		{[]string{"get", "/c"}, `{"a":1}`, ``, true},
+		{[]string{"set", "/b/0", `"x"`, base}, ``, `{"a":1,"b":["x",2]}`, false},
+		{[]string{"set", "/c", `{"d":null}`, base}, ``, `{"a":1,"b":[1,2],"c":{"d":null}}`, false},
+		{[]string{"set", "/b/-", `3`}, `{"b":[]}`, `{"b":[3]}`, false},
+		{[]string{"invert", patch, base}, ``, `[{"op":"replace","path":"/a","from":"","value":1}]`, false},
+		{[]string{"apply", "-", "-"}, `[]`, ``, true},
+		{[]string{"frob"}, ``, ``, true},
+		{[]string{"diff", base, target, base}, ``, ``, true},
+	} {
+		var out bytes.Buffer
+		err := run(test.args, strings.NewReader(test.stdin), &out)
+		if test.fail {
+			if err == nil {
+				t.Errorf("%v should have failed, got %v", test.args, out.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v failed: %v", test.args, err)
+			continue
+		}
+		if got := strings.TrimSpace(out.String()); got != test.output {
+			t.Errorf("%v printed %v, expected %v", test.args, got, test.output)
+		}
+	}
+	// Errors from failed ops say which op failed.
+	err := run([]string{"apply", badPatch, base}, strings.NewReader(""), &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "op 1") {
+		t.Errorf("Expected applying %v to fail at op 1, got %v", badPatch, err)
+	}
+}
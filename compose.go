@@ -0,0 +1,149 @@
+package jsonpatch2
+
+// arrayish tests whether s is a segment that inserts into an array
+// when used as the last segment of an add.  Like Rebase, Compact does
+// not look at the document, so any segment that looks like an array
+// index is assumed to be one.
+func arrayish(s pointerSegment) bool {
+	_, ok := segIndex(s)
+	return ok || s == "-"
+}
+
+// writes returns the pointers that o changes the value at.
+func (o *Operation) writes() []Pointer {
+	switch o.Op {
+	case "test":
+		return nil
+	case "move":
+		return []Pointer{o.from, o.path}
+	default:
+		return []Pointer{o.path}
+	}
+}
+
+// within tests whether everything o touches is inside r.
+func (o *Operation) within(r Pointer) bool {
+	if !r.Contains(o.path) {
+		return false
+	}
+	return o.Op != "move" || r.Contains(o.from)
+}
+
+// touches tests whether o reads or changes anything in r, or shifts
+// the array index r goes through.
+func (o *Operation) touches(r Pointer) bool {
+	ptrs := []Pointer{o.path}
+	if o.Op == "move" || o.Op == "copy" {
+		ptrs = append(ptrs, o.from)
+	}
+	for _, q := range ptrs {
+		if q.Contains(r) || r.Contains(q) {
+			return true
+		}
+	}
+	for _, q := range o.writes() {
+		if o.Op != "replace" && len(q) > 0 && arrayish(q[len(q)-1]) && siblings(q, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// compactInto adds b to the end of res, dropping or merging earlier
+// ops that b makes redundant, and dropping b if it is redundant
+// itself.
+func compactInto(res Patch, b Operation) Patch {
+	r := b.path
+	overwrites := b.Op == "replace" || b.Op == "remove" ||
+		(b.Op == "add" && len(r) > 0 && !arrayish(r[len(r)-1]))
+	drop := make(map[int]bool)
+	keepB := true
+scan:
+	for i := len(res) - 1; i >= 0; i-- {
+		x := &res[i]
+		if !x.touches(r) {
+			continue
+		}
+		switch {
+		case b.Op == "test":
+			// A test right after the value was set, or after an
+			// identical test, always passes.
+			if x.path.String() == r.String() && Equal(x.Value, b.Value) &&
+				(x.Op == "test" || x.Op == "add" || x.Op == "replace") {
+				keepB = false
+			}
+			break scan
+		case !overwrites || len(r) == 0 || x.Op == "test" || !x.within(r):
+			break scan
+		case len(x.path) > len(r):
+			// Everything x did is about to be overwritten or removed.
+			drop[i] = true
+		case x.Op == "remove":
+			break scan
+		case b.Op != "remove" && (x.Op == "add" || x.Op == "replace" || x.Op == "copy"):
+			if x.Op == "copy" {
+				// x might have created the value b replaces.
+				x.Op, x.From, x.from, x.hasValue = "add", "", nil, true
+			}
+			x.Value = b.Value
+			keepB = false
+			break scan
+		case arrayish(r[len(r)-1]):
+			break scan
+		case b.Op == "remove" && x.Op != "replace":
+			// x might have created the value b removes.
+			break scan
+		default:
+			drop[i] = true
+		}
+	}
+	if len(drop) > 0 {
+		kept := make(Patch, 0, len(res))
+		for i := range res {
+			if !drop[i] {
+				kept = append(kept, res[i])
+			}
+		}
+		res = kept
+	}
+	if keepB {
+		res = append(res, b)
+	}
+	return res
+}
+
+// Compact returns a patch that makes the same changes as p with as
+// few ops as it can.  Ops that set a value that is later replaced,
+// and ops inside values that are later replaced or removed, are
+// dropped, adds and replaces followed by a replace of the same value
+// are merged, and tests that must pass because of the ops before them
+// are dropped.  All other tests are kept.
+//
+// The compacted patch makes the same changes to any document p
+// applies to, but may apply to some documents p does not.  Compact
+// does not look at the document, so it cannot tell whether a path
+// segment that looks like an array index is one, and leaves ops that
+// would only be redundant for one or the other alone.
+func (p Patch) Compact() (Patch, error) {
+	if err := p.fixPointers(); err != nil {
+		return nil, err
+	}
+	res := make(Patch, 0, len(p))
+	for _, op := range p {
+		res = compactInto(res, op)
+	}
+	return res, nil
+}
+
+// Compose combines patches into a single compacted patch that makes
+// the same changes as applying each of them in order.
+func Compose(patches ...Patch) (Patch, error) {
+	all := make(Patch, 0)
+	for _, p := range patches {
+		if err := p.fixPointers(); err != nil {
+			return nil, err
+		}
+		all = append(all, p...)
+	}
+	return all.Compact()
+}
@@ -0,0 +1,222 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+var compactTests = []struct {
+	patch string
+	ops   int
+}{
+	{`[{"op":"add","path":"/a","value":1},{"op":"replace","path":"/a","value":2}]`, 1},
+	{`[{"op":"replace","path":"/a","value":1},{"op":"remove","path":"/a"}]`, 1},
+	{`[{"op":"add","path":"/a/b","value":1},{"op":"replace","path":"/a/c","value":1},{"op":"remove","path":"/a"}]`, 1},
+	{`[{"op":"replace","path":"/a","value":1},{"op":"test","path":"/a","value":1}]`, 1},
+	{`[{"op":"test","path":"/a","value":1},{"op":"test","path":"/a","value":1}]`, 1},
+	{`[{"op":"add","path":"/a/0","value":1},{"op":"replace","path":"/b","value":2},{"op":"replace","path":"/a/0","value":3}]`, 2},
+	// These cannot be compacted.
+	{`[{"op":"add","path":"/a/0","value":1},{"op":"remove","path":"/a/0"}]`, 2},
+	{`[{"op":"add","path":"/a","value":1},{"op":"remove","path":"/a"}]`, 2},
+	{`[{"op":"test","path":"/a","value":1},{"op":"replace","path":"/a","value":2}]`, 2},
+	{`[{"op":"replace","path":"/a/b","value":1},{"op":"test","path":"/a","value":{"b":1}},{"op":"remove","path":"/a"}]`, 3},
+	{`[{"op":"replace","path":"/a/1","value":1},{"op":"add","path":"/a/0","value":1},{"op":"replace","path":"/a/1","value":2}]`, 3},
+	{`[{"op":"remove","path":"/a/1"},{"op":"replace","path":"/a/1","value":2}]`, 2},
+	{`[{"op":"copy","from":"/a/b","path":"/c"},{"op":"remove","path":"/a"}]`, 2},
+}
+
+func TestCompact(t *testing.T) {
+	for _, test := range compactTests {
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			t.Fatalf("Bad patch %v: %v", test.patch, err)
+		}
+		res, err := patch.Compact()
+		if err != nil {
+			t.Errorf("Compacting %v failed: %v", test.patch, err)
+			continue
+		}
+		if len(res) != test.ops {
+			buf, _ := json.Marshal(res)
+			t.Errorf("Compacting %v gave %v, expected %d ops", test.patch, string(buf), test.ops)
+		}
+	}
+}
+
+func TestCompactNumericKeys(t *testing.T) {
+	doc := []byte(`{"a":{"0":"x","1":"y"}}`)
+	for _, buf := range []string{
+		`[{"op":"add","path":"/a/0","value":1},{"op":"remove","path":"/a/0"}]`,
+		`[{"op":"add","path":"/a/1","value":1},{"op":"remove","path":"/a/0"},{"op":"remove","path":"/a/1"}]`,
+	} {
+		patch, _ := NewPatch([]byte(buf))
+		compacted, err := patch.Compact()
+		if err != nil {
+			t.Fatalf("Compacting %v failed: %v", buf, err)
+		}
+		want, err, _ := patch.Apply(doc)
+		if err != nil {
+			t.Fatalf("Applying %v failed: %v", buf, err)
+		}
+		got, err, _ := compacted.Apply(doc)
+		if err != nil || string(got) != string(want) {
+			res, _ := json.Marshal(compacted)
+			t.Errorf("Compacted %v to %v, which gave %s (%v) instead of %s", buf, string(res), got, err, want)
+		}
+	}
+}
+
+// randomKey picks an object key.  Some look like array indexes.
+func randomKey(rng *rand.Rand) string {
+	return []string{"a", "b", "0", "1"}[rng.Intn(4)]
+}
+
+// randomValue makes a small random JSON value.
+func randomValue(rng *rand.Rand, depth int) interface{} {
+	switch n := rng.Intn(6); {
+	case n == 0 && depth > 0:
+		res := map[string]interface{}{}
+		for i := rng.Intn(3); i > 0; i-- {
+			res[randomKey(rng)] = randomValue(rng, depth-1)
+		}
+		return res
+	case n == 1 && depth > 0:
+		res := []interface{}{}
+		for i := rng.Intn(4); i > 0; i-- {
+			res = append(res, randomValue(rng, depth-1))
+		}
+		return res
+	case n == 2:
+		return nil
+	default:
+		return json.Number(fmt.Sprint(rng.Intn(5)))
+	}
+}
+
+// pointers lists every pointer in doc.
+func pointers(doc interface{}, at Pointer) []Pointer {
+	res := []Pointer{at}
+	switch t := doc.(type) {
+	case map[string]interface{}:
+		for k, v := range t {
+			res = append(res, pointers(v, at.Append(k))...)
+		}
+	case []interface{}:
+		for i, v := range t {
+			res = append(res, pointers(v, at.Append(fmt.Sprint(i)))...)
+		}
+	}
+	return res
+}
+
+// randomOp makes a random op that can be applied to doc.
+func randomOp(rng *rand.Rand, doc interface{}) Operation {
+	ptrs := pointers(doc, Pointer{})
+	p := ptrs[rng.Intn(len(ptrs))]
+	val, _ := p.Get(doc)
+	target := p
+	switch t := val.(type) {
+	case map[string]interface{}:
+		target = p.Append(randomKey(rng))
+	case []interface{}:
+		if i := rng.Intn(len(t) + 2); i > len(t) {
+			target = p.Append("-")
+		} else {
+			target = p.Append(fmt.Sprint(i))
+		}
+	}
+	from := ptrs[0]
+	if len(ptrs) > 1 {
+		// Copying the whole document into itself makes it grow too fast.
+		from = ptrs[1+rng.Intn(len(ptrs)-1)]
+	}
+	switch rng.Intn(6) {
+	case 0:
+		return Operation{"test", p.String(), "", utils.Clone(val), p, nil, true}
+	case 1:
+		return Operation{"replace", p.String(), "", randomValue(rng, 2), p, nil, true}
+	case 2:
+		return Operation{"remove", p.String(), "", nil, p, nil, false}
+	case 3:
+		return Operation{"move", target.String(), from.String(), nil, target, from, false}
+	case 4:
+		return Operation{"copy", target.String(), from.String(), nil, target, from, false}
+	default:
+		return Operation{"add", target.String(), "", randomValue(rng, 2), target, nil, true}
+	}
+}
+
+// errSkipRound is returned by the apply functions passed to
+// checkMatchesApply for patches they are not expected to handle.
+var errSkipRound = errors.New("skip round")
+
+// checkMatchesApply applies random patches to random documents with
+// apply, and fails if the result differs from what Patch.apply gives.
+func checkMatchesApply(t *testing.T, desc string, apply func(patch Patch, base interface{}) (interface{}, error, int)) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 2000; round++ {
+		base := map[string]interface{}{"a": randomValue(rng, 3), "b": []interface{}{randomValue(rng, 2), randomValue(rng, 2)}}
+		orig := utils.Clone(base)
+		doc := utils.Clone(base)
+		patch := Patch{}
+		for j := rng.Intn(8) + 1; j > 0; j-- {
+			op := randomOp(rng, doc)
+			next, err := op.apply(utils.Clone(doc))
+			if err != nil {
+				continue
+			}
+			patch = append(patch, op)
+			doc = next
+		}
+		res, err, loc := apply(patch, base)
+		if err == errSkipRound {
+			continue
+		}
+		if err != nil || !Equal(res, doc) || !Equal(base, orig) {
+			buf, _ := json.Marshal(patch)
+			src, _ := json.Marshal(orig)
+			got, _ := json.Marshal(res)
+			want, _ := json.Marshal(doc)
+			t.Fatalf("%s %v to %v gave %v (%v at %d), expected %v", desc, string(buf), string(src), string(got), err, loc, string(want))
+		}
+	}
+}
+
+func TestComposeMatchesApply(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 2000; round++ {
+		base := map[string]interface{}{"a": randomValue(rng, 3), "b": []interface{}{randomValue(rng, 2), randomValue(rng, 2)}}
+		doc := utils.Clone(base)
+		patches := []Patch{}
+		for i := rng.Intn(4) + 1; i > 0; i-- {
+			patch := Patch{}
+			for j := rng.Intn(5) + 1; j > 0; j-- {
+				op := randomOp(rng, doc)
+				next, err := op.apply(utils.Clone(doc))
+				if err != nil {
+					continue
+				}
+				patch = append(patch, op)
+				doc = next
+			}
+			patches = append(patches, patch)
+		}
+		composed, err := Compose(patches...)
+		if err != nil {
+			t.Fatalf("Compose failed: %v", err)
+		}
+		res, err, loc := composed.apply(base, ApplyOptions{})
+		if err != nil || !Equal(res, doc) {
+			all, _ := json.Marshal(patches)
+			buf, _ := json.Marshal(composed)
+			baseBuf, _ := json.Marshal(base)
+			t.Fatalf("Composed %v from %v applied to %v failed at %d (%v), or did not give the same result", string(buf), string(all), string(baseBuf), loc, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// toRat returns the exact numeric value of v if it is a number,
+// either from unmarshalled JSON or any of Go's numeric types.
+func toRat(v interface{}) (*big.Rat, bool) {
+	switch t := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(string(t))
+	case nil, bool, string, map[string]interface{}, []interface{}:
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	if _, ok := marshaler(rv); ok {
+		// Its JSON form might not be a number at all.
+		return nil, false
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Rat).SetInt64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Rat).SetUint64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(f), true
+	default:
+		return nil, false
+	}
+}
+
+// floatBits returns the smallest float size out of a and b, or 0 if
+// neither is a Go float.
+func floatBits(a, b interface{}) int {
+	res := 0
+	for _, v := range []interface{}{a, b} {
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.Float32:
+			return 32
+		case reflect.Float64:
+			res = 64
+		}
+	}
+	return res
+}
+
+// Equal tests whether a and b are the same JSON value, as defined by
+// section 4.6 of RFC 6902:
+//
+//   - numbers are equal if they are numerically equal, so 1, 1.0 and
+//     1e0 are all equal, as are an int and a float64 with the same value.
+//   - objects are equal if they have the same members with equal
+//     values, regardless of order.
+//   - arrays are equal if they have equal values in the same order.
+//   - strings, booleans and null are equal if they are the same.
+//
+// a and b can be unmarshalled JSON, or any Go value encoding/json
+// can marshal, in which case their JSON forms are compared.
+func Equal(a, b interface{}) bool {
+	if an, ok := a.(json.Number); ok {
+		if bn, ok := b.(json.Number); ok && an == bn {
+			return true
+		}
+	}
+	if an, ok := toRat(a); ok {
+		bn, ok := toRat(b)
+		if !ok {
+			return false
+		}
+		// Binary floats cannot hold most decimal fractions exactly,
+		// so compare at their precision when either side is one.
+		if bits := floatBits(a, b); bits != 0 {
+			af, _ := an.Float64()
+			bf, _ := bn.Float64()
+			if bits == 32 {
+				return float32(af) == float32(bf)
+			}
+			return af == bf
+		}
+		return an.Cmp(bn) == 0
+	}
+	switch at := a.(type) {
+	case nil, bool, string:
+		switch b.(type) {
+		case nil, bool, string:
+			return a == b
+		case map[string]interface{}, []interface{}, json.Number:
+			return false
+		}
+	case map[string]interface{}:
+		bt, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		if len(at) != len(bt) {
+			return false
+		}
+		for k, av := range at {
+			bv, ok := bt[k]
+			if !ok || !Equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bt, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		if len(at) != len(bt) {
+			return false
+		}
+		for i := range at {
+			if !Equal(at[i], bt[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return convertEqual(a, b)
+}
+
+// convertEqual compares a and b after converting them to unmarshalled
+// JSON, for when at least one of them is not already in that form.
+func convertEqual(a, b interface{}) bool {
+	ac, err := fromGo(reflect.ValueOf(a))
+	if err != nil {
+		return false
+	}
+	bc, err := fromGo(reflect.ValueOf(b))
+	if err != nil {
+		return false
+	}
+	if reflect.TypeOf(ac) == reflect.TypeOf(a) && reflect.TypeOf(bc) == reflect.TypeOf(b) {
+		// Both were already unmarshalled JSON, just of different types.
+		return false
+	}
+	return Equal(ac, bc)
+}
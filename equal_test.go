@@ -0,0 +1,68 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type equalTest struct {
+	a, b  interface{}
+	equal bool
+}
+
+type equalStruct struct {
+	A int      `json:"a"`
+	B []string `json:"b"`
+}
+
+var equalTests = []equalTest{
+	{nil, nil, true},
+	{nil, false, false},
+	{"a", "a", true},
+	{"1", json.Number("1"), false},
+	{json.Number("1"), json.Number("1.0"), true},
+	{json.Number("100"), json.Number("1e2"), true},
+	{json.Number("9007199254740993"), json.Number("9007199254740992"), false},
+	{json.Number("9007199254740993"), json.Number("9007199254740993.0"), true},
+	{json.Number("0.1"), 0.1, true},
+	{json.Number("0.1"), float32(0.1), true},
+	{json.Number("0.1"), json.Number("0.10000000000000001"), false},
+	{json.Number("0.5"), 0.5, true},
+	{5, float64(5), true},
+	{int8(-3), json.Number("-3.0"), true},
+	{uint64(1<<64 - 1), json.Number("18446744073709551615"), true},
+	{float32(0.5), 0.5, true},
+	{true, true, true},
+	{true, 1, false},
+	{map[string]interface{}{"a": 1, "b": []interface{}{"x"}}, map[string]interface{}{"b": []interface{}{"x"}, "a": 1.0}, true},
+	{map[string]interface{}{"a": 1}, map[string]interface{}{"a": 1, "b": 2}, false},
+	{[]interface{}{1, 2}, []interface{}{2, 1}, false},
+	{[]interface{}{"x", 1}, []interface{}{"x", json.Number("1")}, true},
+	{[]string{"x"}, []interface{}{"x"}, true},
+	{map[string]int{"a": 1}, map[string]interface{}{"a": json.Number("1")}, true},
+	{equalStruct{1, []string{"x"}}, map[string]interface{}{"a": 1, "b": []interface{}{"x"}}, true},
+	{equalStruct{1, nil}, map[string]interface{}{"a": 1, "b": []interface{}{}}, false},
+	{[]interface{}{}, map[string]interface{}{}, false},
+}
+
+func TestEqual(t *testing.T) {
+	for _, test := range equalTests {
+		if Equal(test.a, test.b) != test.equal {
+			t.Errorf("Equal(%#v, %#v) should be %v", test.a, test.b, test.equal)
+		}
+		if Equal(test.b, test.a) != test.equal {
+			t.Errorf("Equal(%#v, %#v) should be %v", test.b, test.a, test.equal)
+		}
+	}
+}
+
+func TestTypedTestValues(t *testing.T) {
+	p := Patch{
+		{Op: "test", Path: "/count", Value: 5},
+		{Op: "test", Path: "/tags", Value: []string{"a", "b"}},
+		{Op: "test", Path: "", Value: map[string]interface{}{"tags": []string{"a", "b"}, "count": int64(5)}},
+	}
+	if _, err, idx := p.Apply([]byte(`{"count":5.0,"tags":["a","b"]}`)); err != nil {
+		t.Errorf("Typed test values failed at %d: %v", idx, err)
+	}
+}
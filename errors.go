@@ -0,0 +1,106 @@
+package jsonpatch2
+
+import "fmt"
+
+// ErrorContext describes where a patch or pointer operation failed.
+// It is embedded in all of the error types this package returns.
+type ErrorContext struct {
+	// Operation is the patch operation that failed.  It is nil when
+	// the error came from calling a Pointer method directly.
+	Operation *Operation
+	// OpIndex is the index of Operation in its Patch.
+	OpIndex int
+	// Path is the pointer that was being resolved.
+	Path Pointer
+	// Resolved is the longest prefix of Path that could be resolved.
+	Resolved Pointer
+	// Segment is the first segment of Path that could not be
+	// resolved.  It is empty if all of Path was resolved.
+	Segment string
+}
+
+func (c *ErrorContext) context() *ErrorContext {
+	return c
+}
+
+func (c *ErrorContext) prefix() string {
+	if c.Operation == nil {
+		return ""
+	}
+	return fmt.Sprintf("op %d (%s %s): ", c.OpIndex, c.Operation.Op, c.Operation.Path)
+}
+
+// patchError is implemented by all the error types in this package,
+// and lets Patch.Apply fill in the operation that failed.
+type patchError interface {
+	error
+	context() *ErrorContext
+}
+
+// withOp records op and its index in err if err is one of our errors.
+func withOp(err error, op Operation, idx int) error {
+	if pe, ok := err.(patchError); ok {
+		c := pe.context()
+		c.Operation = &op
+		c.OpIndex = idx
+	}
+	return err
+}
+
+func newContext(p Pointer, i int) ErrorContext {
+	res := ErrorContext{Path: p, Resolved: p[:i]}
+	if i < len(p) {
+		res.Segment = string(p[i])
+	}
+	return res
+}
+
+// TestFailedError is returned when a test operation finds a value
+// different from the one it expected.
+type TestFailedError struct {
+	ErrorContext
+	// Expected is the value the test op was looking for.
+	Expected interface{}
+	// Actual is the value that was actually found.
+	Actual interface{}
+}
+
+func (e *TestFailedError) Error() string {
+	return fmt.Sprintf("%sTest op failed at %v: expected %#v, got %#v", e.prefix(), e.Path, e.Expected, e.Actual)
+}
+
+// PathNotFoundError is returned when a pointer refers to an object
+// member that does not exist, or tries to index into something that
+// cannot be indexed.
+type PathNotFoundError struct {
+	ErrorContext
+	// Reason describes why Segment could not be resolved.
+	Reason string
+}
+
+func (e *PathNotFoundError) Error() string {
+	return fmt.Sprintf("%s%v does not refer to an existing location: %s", e.prefix(), e.Path, e.Reason)
+}
+
+// IndexOutOfRangeError is returned when a pointer refers to an array
+// element that does not exist.
+type IndexOutOfRangeError struct {
+	ErrorContext
+	// Len is the length of the array that was indexed.
+	Len int
+}
+
+func (e *IndexOutOfRangeError) Error() string {
+	return fmt.Sprintf("%sIndex %s out of bounds for array of length %d at %v", e.prefix(), e.Segment, e.Len, e.Resolved)
+}
+
+// InvalidOpError is returned when a patch operation is malformed.
+type InvalidOpError struct {
+	ErrorContext
+	// Reason describes what is wrong with the operation.
+	Reason string
+}
+
+func (e *InvalidOpError) Error() string {
+	return e.prefix() + e.Reason
+}
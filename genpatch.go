@@ -1,28 +1,28 @@
 package jsonpatch2
 
 import (
-	"encoding/json"
 	"reflect"
+	"strconv"
 
 	"github.com/VictorLowther/jsonpatch2/utils"
 )
 
-// This generator does not create copy or move patch ops, and I don't
-// care enough to optimize it to do so.  Ditto for slice handling.
+// This generator does not create copy or move patch ops on its own,
+// see moveGen for that.
 // There is a lot of optimization that could be done here, but it can get complex real quick.
 func basicGen(base, target interface{}, paranoid, pretest bool, ptr Pointer) Patch {
 	res := make(Patch, 0)
 	pstr := ptr.String()
 	if pretest {
-		res = append(res, Operation{"test", pstr, "", utils.Clone(base), ptr, nil})
+		res = append(res, Operation{"test", pstr, "", utils.Clone(base), ptr, nil, true})
 		paranoid = false
 		pretest = false
 	}
 	if reflect.TypeOf(base) != reflect.TypeOf(target) {
 		if paranoid {
-			res = append(res, Operation{"test", pstr, "", utils.Clone(base), ptr, nil})
+			res = append(res, Operation{"test", pstr, "", utils.Clone(base), ptr, nil, true})
 		}
-		res = append(res, Operation{"replace", pstr, "", utils.Clone(target), ptr, nil})
+		res = append(res, Operation{"replace", pstr, "", utils.Clone(target), ptr, nil, true})
 		return res
 	}
 	switch baseVal := base.(type) {
@@ -37,9 +37,9 @@ func basicGen(base, target interface{}, paranoid, pretest bool, ptr Pointer) Pat
 			if !ok {
 				// Generate a remove op
 				if paranoid {
-					res = append(res, Operation{"test", newPstr, "", utils.Clone(oldVal), newPtr, nil})
+					res = append(res, Operation{"test", newPstr, "", utils.Clone(oldVal), newPtr, nil, true})
 				}
-				res = append(res, Operation{"remove", newPstr, "", nil, newPtr, nil})
+				res = append(res, Operation{"remove", newPstr, "", nil, newPtr, nil, false})
 			} else {
 				subPatch := basicGen(oldVal, newVal, paranoid, pretest, newPtr)
 				res = append(res, subPatch...)
@@ -53,17 +53,68 @@ func basicGen(base, target interface{}, paranoid, pretest bool, ptr Pointer) Pat
 			}
 			newPtr := ptr.Append(k)
 			newPstr := newPtr.String()
-			res = append(res, Operation{"add", newPstr, "", utils.Clone(newVal), newPtr, nil})
+			res = append(res, Operation{"add", newPstr, "", utils.Clone(newVal), newPtr, nil, true})
 		}
-	// case []interface{}:
-	// Eventually, add code to handle slices more
-	// efficiently.  For now, through, be dumb.
+	case []interface{}:
+		res = append(res, sliceGen(baseVal, target.([]interface{}), paranoid, pretest, ptr)...)
 	default:
-		if !reflect.DeepEqual(base, target) {
+		if !Equal(base, target) {
 			if paranoid {
-				res = append(res, Operation{"test", pstr, "", utils.Clone(base), ptr, nil})
+				res = append(res, Operation{"test", pstr, "", utils.Clone(base), ptr, nil, true})
 			}
-			res = append(res, Operation{"replace", pstr, "", utils.Clone(target), ptr, nil})
+			res = append(res, Operation{"replace", pstr, "", utils.Clone(target), ptr, nil, true})
+		}
+	}
+	return res
+}
+
+// sliceGen generates the ops needed to turn base into target
+// element by element.  Runs of removed elements followed by runs of
+// added elements are paired up and recursed into, so a changed object
+// in the middle of an array only results in ops for the parts of it
+// that changed.
+func sliceGen(base, target []interface{}, paranoid, pretest bool, ptr Pointer) Patch {
+	res := make(Patch, 0)
+	// idx is the position in the array as it is being patched, bi and
+	// ti are the positions in base and target.
+	idx, bi, ti, curLen := 0, 0, 0, len(base)
+	edits := diffSlices(base, target)
+	for i := 0; i < len(edits); {
+		if edits[i] == editKeep {
+			idx, bi, ti = idx+1, bi+1, ti+1
+			i++
+			continue
+		}
+		dels, adds := 0, 0
+		for ; i < len(edits) && edits[i] == editDel; i++ {
+			dels++
+		}
+		for ; i < len(edits) && edits[i] == editAdd; i++ {
+			adds++
+		}
+		for dels > 0 && adds > 0 {
+			res = append(res, basicGen(base[bi], target[ti], paranoid, pretest, ptr.Append(strconv.Itoa(idx)))...)
+			idx, bi, ti = idx+1, bi+1, ti+1
+			dels, adds = dels-1, adds-1
+		}
+		for ; dels > 0; dels-- {
+			newPtr := ptr.Append(strconv.Itoa(idx))
+			newPstr := newPtr.String()
+			if paranoid {
+				res = append(res, Operation{"test", newPstr, "", utils.Clone(base[bi]), newPtr, nil, true})
+			}
+			res = append(res, Operation{"remove", newPstr, "", nil, newPtr, nil, false})
+			bi++
+			curLen--
+		}
+		for ; adds > 0; adds-- {
+			newPtr := ptr.Append(strconv.Itoa(idx))
+			if idx == curLen {
+				newPtr = ptr.Append("-")
+			}
+			res = append(res, Operation{"add", newPtr.String(), "", utils.Clone(target[ti]), newPtr, nil, true})
+			idx, ti = idx+1, ti+1
+			curLen++
 		}
 	}
 	return res
@@ -78,7 +129,21 @@ func Generate(base, target []byte, paranoid bool) (Patch, error) {
 	return GenerateFull(base, target, paranoid, false)
 }
 
-// Generate generates a JSON Patch that will modify base into target.
+// GenerateOptions controls the shape of the patches GenerateWithOptions
+// creates.
+type GenerateOptions struct {
+	// Paranoid adds a test op before every changed item.
+	Paranoid bool
+	// Pretest adds a test op for the entire base document at the
+	// start of the patch.  It overrides Paranoid.
+	Pretest bool
+	// MoveAndCopy turns adds of values that are removed elsewhere
+	// into move ops, and adds of values that are present and
+	// unchanged elsewhere into copy ops.
+	MoveAndCopy bool
+}
+
+// GenerateFull generates a JSON Patch that will modify base into target.
 // If paranoid is true, then the generated patch with have test checks for
 // changed item.
 // If pretest is true, then the generated patch with have test ALL
@@ -86,12 +151,45 @@ func Generate(base, target []byte, paranoid bool) (Patch, error) {
 //
 // base and target must be byte arrays containing valid JSON
 func GenerateFull(base, target []byte, paranoid, pretest bool) (Patch, error) {
+	return GenerateWithOptions(base, target, GenerateOptions{Paranoid: paranoid, Pretest: pretest})
+}
+
+// GenerateWithOptions generates a JSON Patch that will modify base
+// into target, shaped according to opts.
+//
+// base and target must be byte arrays containing valid JSON
+func GenerateWithOptions(base, target []byte, opts GenerateOptions) (Patch, error) {
 	var rawBase, rawTarget interface{}
-	if err := json.Unmarshal(base, &rawBase); err != nil {
+	if err := utils.Unmarshal(base, &rawBase); err != nil {
+		return nil, err
+	}
+	if err := utils.Unmarshal(target, &rawTarget); err != nil {
 		return nil, err
 	}
-	if err := json.Unmarshal(target, &rawTarget); err != nil {
+	return generate(rawBase, rawTarget, opts), nil
+}
+
+// GenerateFromValues generates a JSON Patch that will modify the JSON
+// representation of base into that of target.  base and target can
+// be any Go values that encoding/json can marshal, and the generated
+// patch is the same one GenerateWithOptions would make from their
+// marshalled forms.
+func GenerateFromValues(base, target interface{}, opts GenerateOptions) (Patch, error) {
+	rawBase, err := fromGo(reflect.ValueOf(base))
+	if err != nil {
+		return nil, err
+	}
+	rawTarget, err := fromGo(reflect.ValueOf(target))
+	if err != nil {
 		return nil, err
 	}
-	return basicGen(rawBase, rawTarget, paranoid, pretest, make(Pointer, 0)), nil
+	return generate(rawBase, rawTarget, opts), nil
+}
+
+func generate(base, target interface{}, opts GenerateOptions) Patch {
+	res := basicGen(base, target, opts.Paranoid, opts.Pretest, make(Pointer, 0))
+	if opts.MoveAndCopy {
+		res = moveGen(base, target, res, opts.Paranoid && !opts.Pretest)
+	}
+	return res
 }
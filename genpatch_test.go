@@ -0,0 +1,154 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type genTest struct {
+	src    string
+	final  string
+	maxOps int
+}
+
+var arrayGenTests = []genTest{
+	{`[]`, `[1,2,3]`, 3},
+	{`[1,2,3]`, `[]`, 3},
+	{`[1,2,3]`, `[3,2,1]`, 2},
+	{`[1,2,3,4,5]`, `[0,1,2,4,5,6]`, 3},
+	{`["a","b","c","d"]`, `["b","x","d","y"]`, 3},
+	{`[{"a":1},{"b":2},{"c":3}]`, `[{"b":2},{"c":4}]`, 2},
+	{`[[1,2],[3,4]]`, `[[1,2,5],[4]]`, 2},
+	{`{"foo":[1,{"bar":[1,2]}]}`, `{"foo":[{"bar":[2,3]},1]}`, 4},
+	{`[1,"a",true,null]`, `[{"x":1},"a",null]`, 2},
+}
+
+func checkGen(t *testing.T, src, final string, paranoid bool, maxOps int) Patch {
+	patch, err := GenerateFull([]byte(src), []byte(final), paranoid, false)
+	if err != nil {
+		t.Errorf("Failed to generate patch from `%v` to `%v`: %v", src, final, err)
+		return nil
+	}
+	buf, _ := json.Marshal(patch)
+	if maxOps > 0 && len(patch) > maxOps {
+		t.Errorf("Patch from `%v` to `%v` has %d ops, expected at most %d: %v", src, final, len(patch), maxOps, string(buf))
+	}
+	resBytes, err, idx := patch.Apply([]byte(src))
+	if err != nil {
+		t.Errorf("Generated patch %v failed at %d: %v", string(buf), idx, err)
+		return nil
+	}
+	var res, want interface{}
+	json.Unmarshal(resBytes, &res)
+	json.Unmarshal([]byte(final), &want)
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("Generated patch %v turned `%v` into `%v`, not `%v`", string(buf), src, string(resBytes), final)
+	}
+	return patch
+}
+
+func TestArrayGenerate(t *testing.T) {
+	for _, test := range arrayGenTests {
+		checkGen(t, test.src, test.final, false, test.maxOps)
+		paranoid := checkGen(t, test.src, test.final, true, 0)
+		// Paranoid patches must still fail against a different base.
+		if len(paranoid) > 0 && paranoid[0].Op == "test" {
+			if _, err, _ := paranoid.Apply([]byte(`[["changed"]]`)); err == nil {
+				t.Errorf("Paranoid patch from `%v` to `%v` applied to a changed document", test.src, test.final)
+			}
+		}
+	}
+}
+
+func TestLargeArrayAppend(t *testing.T) {
+	base := make([]int, 5000)
+	for i := range base {
+		base[i] = i
+	}
+	src, _ := json.Marshal(base)
+	final, _ := json.Marshal(append(base, 5000))
+	patch := checkGen(t, string(src), string(final), true, 1)
+	if len(patch) != 1 || patch[0].Path != "/-" {
+		buf, _ := json.Marshal(patch)
+		t.Errorf("Expected a single append op, got %v", string(buf))
+	}
+}
+
+var moveGenTests = []struct {
+	src, final string
+	ops        []string
+}{
+	{
+		`{"a":{"x":[1,2,3]},"c":1}`,
+		`{"b":{"x":[1,2,3]},"c":1}`,
+		[]string{"move"},
+	},
+	{
+		`{"a":{"x":[1,2,3]}}`,
+		`{"a":{"x":[1,2,3]},"b":{"x":[1,2,3]}}`,
+		[]string{"copy"},
+	},
+	{
+		`{"a":{"x":1},"l":[1,2]}`,
+		`{"l":[1,{"x":1},2]}`,
+		[]string{"move"},
+	},
+	{
+		`{"l":[{"x":1},2],"m":{}}`,
+		`{"l":[2],"m":{"n":{"x":1}}}`,
+		[]string{"remove", "add"},
+	},
+	{
+		`{"a":{"x":1},"b":{"y":{"z":[true]}}}`,
+		`{"c":{"x":1},"b":{"y":{"z":[true]}},"d":{"z":[true]},"e":{"x":1}}`,
+		[]string{"move", "copy", "add"},
+	},
+	{
+		`{"a":1}`,
+		`{"b":1}`,
+		[]string{"remove", "add"},
+	},
+}
+
+func opNames(p Patch, skipTests bool) map[string]int {
+	res := make(map[string]int)
+	for _, op := range p {
+		if skipTests && op.Op == "test" {
+			continue
+		}
+		res[op.Op]++
+	}
+	return res
+}
+
+func TestMoveGenerate(t *testing.T) {
+	for _, test := range moveGenTests {
+		want := make(map[string]int)
+		for _, op := range test.ops {
+			want[op]++
+		}
+		for _, paranoid := range []bool{false, true} {
+			patch, err := GenerateWithOptions([]byte(test.src), []byte(test.final), GenerateOptions{Paranoid: paranoid, MoveAndCopy: true})
+			if err != nil {
+				t.Errorf("Failed to generate patch: %v", err)
+				continue
+			}
+			buf, _ := json.Marshal(patch)
+			if got := opNames(patch, true); !reflect.DeepEqual(got, want) {
+				t.Errorf("Patch from `%v` to `%v` was %v, expected ops %v", test.src, test.final, string(buf), test.ops)
+			}
+			resBytes, err, idx := patch.Apply([]byte(test.src))
+			if err != nil {
+				t.Errorf("Generated patch %v failed at %d: %v", string(buf), idx, err)
+				continue
+			}
+			var res, final interface{}
+			json.Unmarshal(resBytes, &res)
+			json.Unmarshal([]byte(test.final), &final)
+			if !reflect.DeepEqual(res, final) {
+				t.Errorf("Generated patch %v yielded `%v`, not `%v`", string(buf), string(resBytes), test.final)
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package jsonpatch2
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+// resolveParent walks all but the last segment of p in doc, replacing
+// any relative array indexes with absolute ones.  It returns the
+// resolved pointer to the parent along with the parent itself.
+func (p Pointer) resolveParent(doc interface{}) (Pointer, interface{}, error) {
+	res := make(Pointer, 0, len(p))
+	for i, seg := range p[:len(p)-1] {
+		switch t := doc.(type) {
+		case map[string]interface{}:
+			found, ok := t[string(seg)]
+			if !ok {
+				return nil, nil, p.missing(i)
+			}
+			res = append(res, seg)
+			doc = found
+		case []interface{}:
+			index, err := p.offset(i, len(t))
+			if err != nil {
+				return nil, nil, err
+			}
+			res = append(res, pointerSegment(strconv.Itoa(index)))
+			doc = t[index]
+		default:
+			return nil, nil, p.notContainer(i)
+		}
+	}
+	return res, doc, nil
+}
+
+func invOp(op string, path Pointer, val interface{}) Operation {
+	return Operation{op, path.String(), "", val, path, nil, op != "remove"}
+}
+
+// invertPut returns the op that will undo putting a value at p in doc.
+func (p Pointer) invertPut(doc interface{}) (Operation, error) {
+	if len(p) == 0 {
+		return invOp("replace", p, doc), nil
+	}
+	parent, container, err := p.resolveParent(doc)
+	if err != nil {
+		return Operation{}, err
+	}
+	selector, _ := p.Chop()
+	switch t := container.(type) {
+	case map[string]interface{}:
+		path := parent.Append(selector)
+		if old, ok := t[selector]; ok {
+			return invOp("replace", path, old), nil
+		}
+		return invOp("remove", path, nil), nil
+	case []interface{}:
+		index := len(t)
+		if selector != "-" && selector != strconv.Itoa(len(t)) {
+			index, err = p.offset(len(p)-1, len(t))
+			if err != nil {
+				return Operation{}, err
+			}
+		}
+		return invOp("remove", parent.Append(strconv.Itoa(index)), nil), nil
+	default:
+		return Operation{}, p.notContainer(len(p) - 1)
+	}
+}
+
+// invertRemove returns the op that will undo removing the value at p in doc.
+func (p Pointer) invertRemove(doc interface{}) (Operation, error) {
+	if len(p) == 0 {
+		return Operation{}, &InvalidOpError{ErrorContext{Path: p}, "Cannot remove the whole document"}
+	}
+	parent, container, err := p.resolveParent(doc)
+	if err != nil {
+		return Operation{}, err
+	}
+	selector, _ := p.Chop()
+	switch t := container.(type) {
+	case map[string]interface{}:
+		old, ok := t[selector]
+		if !ok {
+			return Operation{}, p.missing(len(p) - 1)
+		}
+		return invOp("add", parent.Append(selector), old), nil
+	case []interface{}:
+		index, err := p.offset(len(p)-1, len(t))
+		if err != nil {
+			return Operation{}, err
+		}
+		// Adding at len(t) is only possible via the append selector.
+		if index == len(t)-1 {
+			selector = "-"
+		} else {
+			selector = strconv.Itoa(index)
+		}
+		return invOp("add", parent.Append(selector), t[index]), nil
+	default:
+		return Operation{}, p.notContainer(len(p) - 1)
+	}
+}
+
+// invertValue returns an op of type op that refers to the current
+// value at p in doc.
+func (p Pointer) invertValue(op string, doc interface{}) (Operation, error) {
+	if len(p) == 0 {
+		return invOp(op, p, doc), nil
+	}
+	parent, container, err := p.resolveParent(doc)
+	if err != nil {
+		return Operation{}, err
+	}
+	selector, _ := p.Chop()
+	switch t := container.(type) {
+	case map[string]interface{}:
+		old, ok := t[selector]
+		if !ok {
+			return Operation{}, p.missing(len(p) - 1)
+		}
+		return invOp(op, parent.Append(selector), old), nil
+	case []interface{}:
+		index, err := p.offset(len(p)-1, len(t))
+		if err != nil {
+			return Operation{}, err
+		}
+		return invOp(op, parent.Append(strconv.Itoa(index)), t[index]), nil
+	default:
+		return Operation{}, p.notContainer(len(p) - 1)
+	}
+}
+
+// invert computes the inverse of o against doc, returning the ops
+// that undo o (in the order they should be applied) and doc with o
+// applied.  The values in the returned ops are not copied, so they
+// can share values with doc that later ops change.
+func (o *Operation) invert(doc interface{}) (Patch, interface{}, error) {
+	switch o.Op {
+	case "test":
+		inv, err := o.path.invertValue("test", doc)
+		if err != nil {
+			return nil, doc, err
+		}
+		return Patch{inv}, doc, o.path.Test(doc, o.Value)
+	case "replace":
+		inv, err := o.path.invertValue("replace", doc)
+		if err != nil {
+			return nil, doc, err
+		}
+		doc, err = o.path.Replace(doc, utils.Clone(o.Value))
+		return Patch{inv}, doc, err
+	case "add":
+		inv, err := o.path.invertPut(doc)
+		if err != nil {
+			return nil, doc, err
+		}
+		doc, err = o.path.Put(doc, utils.Clone(o.Value))
+		return Patch{inv}, doc, err
+	case "remove":
+		inv, err := o.path.invertRemove(doc)
+		if err != nil {
+			return nil, doc, err
+		}
+		doc, err = o.path.Remove(doc)
+		return Patch{inv}, doc, err
+	case "copy", "move":
+		val, err := o.from.Get(doc)
+		if err != nil {
+			return nil, doc, err
+		}
+		var undoRemove Operation
+		if o.Op == "move" {
+			if err = o.from.checkMove(o.path); err != nil {
+				return nil, doc, err
+			}
+			if undoRemove, err = o.from.invertRemove(doc); err != nil {
+				return nil, doc, err
+			}
+			if doc, err = o.from.Remove(doc); err != nil {
+				return nil, doc, err
+			}
+		} else {
+			val = utils.Clone(val)
+		}
+		// If a move fails after the remove, undoing the remove is
+		// still needed to get doc back.
+		var partial Patch
+		if o.Op == "move" {
+			partial = Patch{undoRemove}
+		}
+		undoPut, err := o.path.invertPut(doc)
+		if err != nil {
+			return partial, doc, err
+		}
+		if doc, err = o.path.Put(doc, val); err != nil {
+			return partial, doc, err
+		}
+		if o.Op == "copy" {
+			return Patch{undoPut}, doc, nil
+		}
+		if undoPut.Op == "remove" && !undoPut.path.Contains(undoRemove.path) {
+			// Nothing was overwritten, so just move the value back.
+			return Patch{{"move", undoRemove.Path, undoPut.Path, nil, undoRemove.path, undoPut.path, false}}, doc, nil
+		}
+		return Patch{undoPut, undoRemove}, doc, nil
+	default:
+		return nil, doc, &InvalidOpError{ErrorContext{Path: o.path}, fmt.Sprintf("Invalid op %v", o.Op)}
+	}
+}
+
+func (p Patch) invert(base interface{}) (result Patch, err error, loc int) {
+	doc := utils.Clone(base)
+	undo := make([]Patch, len(p))
+	for i := range p {
+		undo[i], doc, err = p[i].invert(doc)
+		if err != nil {
+			return nil, withOp(err, p[i], i), i
+		}
+		// Later ops can change values the undo ops share with doc.
+		for j := range undo[i] {
+			undo[i][j].Value = utils.Clone(undo[i][j].Value)
+		}
+	}
+	result = make(Patch, 0, len(p))
+	for i := len(undo) - 1; i >= 0; i-- {
+		result = append(result, undo[i]...)
+	}
+	return result, nil, 0
+}
+
+// Invert computes a patch that undoes the changes p makes to base
+// (which must be a byte array containing valid JSON).  Applying p to
+// base and then applying the inverted patch to the result yields
+// base again.  If err is returned, the returned int is the index of
+// the operation in p that could not be applied to base.
+func (p Patch) Invert(base []byte) (result Patch, err error, loc int) {
+	var rawBase interface{}
+	if err = utils.Unmarshal(base, &rawBase); err != nil {
+		return nil, err, 0
+	}
+	if err = p.fixPointers(); err != nil {
+		return nil, err, 0
+	}
+	return p.invert(rawBase)
+}
@@ -0,0 +1,149 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type invertTest struct {
+	src   string
+	patch string
+	inv   string
+}
+
+var invertTests = []invertTest{
+	{
+		`{"foo":[[1],2]}`,
+		`[{"op":"move","from":"/foo/0/0","path":"/foo/0"}]`,
+		`[{"op":"remove","path":"/foo/0"},{"op":"add","path":"/foo/0/-","value":1}]`,
+	},
+	{
+		`{"foo":[1]}`,
+		`[{"op":"add","path":"/foo/1","value":2}]`,
+		`[{"op":"remove","path":"/foo/1"}]`,
+	},
+	{
+		`{"foo":5}`,
+		`[{"op":"add","path":"/bar","value":6}]`,
+		`[{"op":"remove","path":"/bar"}]`,
+	},
+	{
+		`{"foo":5}`,
+		`[{"op":"add","path":"/foo","value":6}]`,
+		`[{"op":"replace","path":"/foo","value":5}]`,
+	},
+	{
+		`{"foo":5,"bar":[1,2]}`,
+		`[{"op":"remove","path":"/bar"}]`,
+		`[{"op":"add","path":"/bar","value":[1,2]}]`,
+	},
+	{
+		`{"foo":[1,2,3]}`,
+		`[{"op":"remove","path":"/foo/-1"},{"op":"remove","path":"/foo/0"}]`,
+		`[{"op":"add","path":"/foo/0","value":1},{"op":"add","path":"/foo/-","value":3}]`,
+	},
+	{
+		`{"foo":[1,2,3]}`,
+		`[{"op":"add","path":"/foo/-","value":4},{"op":"add","path":"/foo/1","value":5}]`,
+		`[{"op":"remove","path":"/foo/1"},{"op":"remove","path":"/foo/3"}]`,
+	},
+	{
+		`{"foo":{"bar":5}}`,
+		`[{"op":"test","path":"/foo/bar","value":5},{"op":"replace","path":"/foo/bar","value":6}]`,
+		`[{"op":"replace","path":"/foo/bar","value":5},{"op":"test","path":"/foo/bar","value":5}]`,
+	},
+	{
+		`{"foo":{"bar":5}}`,
+		`[{"op":"move","from":"/foo","path":"/baz"}]`,
+		`[{"op":"move","from":"/baz","path":"/foo"}]`,
+	},
+	{
+		`{"foo":{"bar":5},"baz":1}`,
+		`[{"op":"move","from":"/foo","path":"/baz"}]`,
+		`[{"op":"replace","path":"/baz","value":1},{"op":"add","path":"/foo","value":{"bar":5}}]`,
+	},
+	{
+		`{"foo":{"bar":5}}`,
+		`[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":6}]`,
+		`[{"op":"replace","path":"/baz/bar","value":5},{"op":"remove","path":"/baz"}]`,
+	},
+	{
+		`{"a":{"x":1},"b":2}`,
+		`[{"op":"move","from":"/a","path":"/b"},{"op":"replace","path":"/b/x","value":5}]`,
+		`[{"op":"replace","path":"/b/x","value":1},{"op":"replace","path":"/b","value":2},{"op":"add","path":"/a","value":{"x":1}}]`,
+	},
+	{
+		`{"foo":5}`,
+		`[{"op":"replace","path":"","value":[1]}]`,
+		`[{"op":"replace","path":"","value":{"foo":5}}]`,
+	},
+}
+
+func TestInvert(t *testing.T) {
+	for _, test := range invertTests {
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			t.Errorf("Failed to make a Patch from `%v`: %v", test.patch, err)
+			continue
+		}
+		inv, err, idx := patch.Invert([]byte(test.src))
+		if err != nil {
+			t.Errorf("Failed to invert `%v` at %d: %v", test.patch, idx, err)
+			continue
+		}
+		want, err := NewPatch([]byte(test.inv))
+		if err != nil {
+			t.Errorf("Failed to make a Patch from `%v`: %v", test.inv, err)
+			continue
+		}
+		buf, _ := json.Marshal(inv)
+		if !reflect.DeepEqual(inv, want) {
+			t.Errorf("Inverse of `%v` was `%v`, expected `%v`", test.patch, string(buf), test.inv)
+		}
+		patched, err, idx := patch.Apply([]byte(test.src))
+		if err != nil {
+			t.Errorf("Failed to apply `%v` at %d: %v", test.patch, idx, err)
+			continue
+		}
+		restored, err, idx := inv.Apply(patched)
+		if err != nil {
+			t.Errorf("Failed to apply inverse `%v` at %d: %v", string(buf), idx, err)
+			continue
+		}
+		var res, src interface{}
+		json.Unmarshal(restored, &res)
+		json.Unmarshal([]byte(test.src), &src)
+		if !reflect.DeepEqual(res, src) {
+			t.Errorf("Inverse `%v` yielded `%v`, not `%v`", string(buf), string(restored), test.src)
+		}
+	}
+}
+
+func TestInvertFailure(t *testing.T) {
+	patch, _ := NewPatch([]byte(`[{"op":"add","path":"/a","value":1},{"op":"remove","path":"/b"}]`))
+	if _, err, idx := patch.Invert([]byte(`{}`)); err == nil || idx != 1 {
+		t.Errorf("Expected inverting a patch that does not apply to fail at 1, got %v at %d", err, idx)
+	}
+}
+
+func TestInvertFailedMove(t *testing.T) {
+	patch, _ := NewPatch([]byte(`[{"op":"move","from":"/a","path":"/b/c"}]`))
+	var doc interface{}
+	json.Unmarshal([]byte(`{"a":1}`), &doc)
+	// The remove from /a happens before the add to /b/c fails, so the
+	// undo for it is still needed.
+	undo, doc, err := patch[0].invert(doc)
+	if err == nil {
+		t.Fatalf("Expected the move to fail")
+	}
+	if len(undo) != 1 || undo[0].Op != "add" || undo[0].Path != "/a" {
+		t.Fatalf("Expected an add to /a as the undo, got %v", undo)
+	}
+	if doc, err, _ = undo.apply(doc, ApplyOptions{}); err != nil {
+		t.Fatalf("Failed to apply the undo: %v", err)
+	}
+	if buf, _ := json.Marshal(doc); string(buf) != `{"a":1}` {
+		t.Errorf("Undo gave %s", buf)
+	}
+}
@@ -0,0 +1,161 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+// Conflict describes a part of a document that was changed in
+// different ways by both sides of a ThreeWayMerge or Rebase.
+type Conflict struct {
+	// Path points at the smallest part of the base document that
+	// contains all of the conflicting changes.  Changes to different
+	// elements of the same array are considered to conflict with
+	// each other, so Path never points into an array.
+	Path Pointer
+	// Ours and Theirs are the ops that would have made each side's
+	// changes under Path.
+	Ours, Theirs Patch
+}
+
+// mergeUnit is a group of overlapping changes from either side of a
+// three way merge.  ours and theirs are op indexes into each side's
+// patch.
+type mergeUnit struct {
+	path         Pointer
+	ours, theirs []int
+}
+
+// changeRoot returns the part of p that a change at p is considered
+// to affect in base.  Ops that touch array elements are indexed
+// against each other, so changes to any element of an array are
+// treated as changes to the whole array.
+func changeRoot(base interface{}, p Pointer) Pointer {
+	cur := base
+	for i, seg := range p {
+		switch t := cur.(type) {
+		case []interface{}:
+			return p[:i]
+		case map[string]interface{}:
+			next, ok := t[string(seg)]
+			if !ok {
+				return p
+			}
+			cur = next
+		default:
+			return p
+		}
+	}
+	return p
+}
+
+// sameChange tests whether a and b, which only change base under
+// path, leave the same value there.  Comparing the ops themselves is
+// not enough, since the same change can be made by ops in a different
+// order.
+func sameChange(base interface{}, path Pointer, a, b Patch) bool {
+	aRes, aErr, _ := a.apply(base, ApplyOptions{ShareUnchanged: true})
+	bRes, bErr, _ := b.apply(base, ApplyOptions{ShareUnchanged: true})
+	if aErr != nil || bErr != nil {
+		return false
+	}
+	aVal, aErr := path.Get(aRes)
+	bVal, bErr := path.Get(bRes)
+	if aErr != nil || bErr != nil {
+		return aErr != nil && bErr != nil
+	}
+	return Equal(aVal, bVal)
+}
+
+func pick(p Patch, idxs []int) Patch {
+	sort.Ints(idxs)
+	res := make(Patch, len(idxs))
+	for i, idx := range idxs {
+		res[i] = p[idx]
+	}
+	return res
+}
+
+// groupChanges sorts the ops in ours and theirs into units such that
+// ops in different units do not overlap.
+func groupChanges(base interface{}, ours, theirs Patch) []*mergeUnit {
+	units := []*mergeUnit{}
+	add := func(idx int, path Pointer, isOurs bool) {
+		unit := &mergeUnit{path: path}
+		if isOurs {
+			unit.ours = []int{idx}
+		} else {
+			unit.theirs = []int{idx}
+		}
+		kept := units[:0]
+		for _, u := range units {
+			if !u.path.Contains(unit.path) && !unit.path.Contains(u.path) {
+				kept = append(kept, u)
+				continue
+			}
+			if len(u.path) < len(unit.path) {
+				unit.path = u.path
+			}
+			unit.ours = append(unit.ours, u.ours...)
+			unit.theirs = append(unit.theirs, u.theirs...)
+		}
+		units = append(kept, unit)
+	}
+	for i, op := range ours {
+		add(i, changeRoot(base, op.path), true)
+	}
+	for i, op := range theirs {
+		add(i, changeRoot(base, op.path), false)
+	}
+	return units
+}
+
+// ThreeWayMerge merges the changes made to base in ours and theirs.
+// Changes made by only one side, and changes that both sides made in
+// the same way, are applied to base to make result.  Changes that
+// overlap but differ are left out of result, which keeps the base
+// value there, and are returned as conflicts sorted by path.
+// Overlapping changes are ones where the path of one contains the
+// path of the other, and any change to an array element overlaps
+// with all other changes to the same array.
+//
+// base, ours, and theirs must be byte arrays containing valid JSON
+func ThreeWayMerge(base, ours, theirs []byte) (result []byte, conflicts []Conflict, err error) {
+	var rawBase, rawOurs, rawTheirs interface{}
+	if err = utils.Unmarshal(base, &rawBase); err != nil {
+		return nil, nil, err
+	}
+	if err = utils.Unmarshal(ours, &rawOurs); err != nil {
+		return nil, nil, err
+	}
+	if err = utils.Unmarshal(theirs, &rawTheirs); err != nil {
+		return nil, nil, err
+	}
+	oursPatch := basicGen(rawBase, rawOurs, false, false, make(Pointer, 0))
+	theirsPatch := basicGen(rawBase, rawTheirs, false, false, make(Pointer, 0))
+	oursApply, theirsApply := []int{}, []int{}
+	conflicts = []Conflict{}
+	for _, unit := range groupChanges(rawBase, oursPatch, theirsPatch) {
+		o, t := pick(oursPatch, unit.ours), pick(theirsPatch, unit.theirs)
+		switch {
+		case len(t) == 0 || sameChange(rawBase, unit.path, o, t):
+			oursApply = append(oursApply, unit.ours...)
+		case len(o) == 0:
+			theirsApply = append(theirsApply, unit.theirs...)
+		default:
+			conflicts = append(conflicts, Conflict{unit.path, o, t})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Path.String() < conflicts[j].Path.String()
+	})
+	merged := append(pick(oursPatch, oursApply), pick(theirsPatch, theirsApply)...)
+	res, err, _ := merged.apply(rawBase, ApplyOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err = json.Marshal(res)
+	return result, conflicts, err
+}
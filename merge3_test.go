@@ -0,0 +1,77 @@
+package jsonpatch2
+
+import (
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+var threeWayTests = []struct {
+	base, ours, theirs, result string
+	conflicts                  []string
+}{
+	{`{"a":1,"b":2}`, `{"a":3,"b":2}`, `{"a":1,"b":4}`, `{"a":3,"b":4}`, nil},
+	{`{"a":1}`, `{"a":1,"b":2}`, `{"a":1,"c":3}`, `{"a":1,"b":2,"c":3}`, nil},
+	{`{"a":1,"b":2}`, `{"b":2}`, `{"a":1}`, `{}`, nil},
+	{`{"a":1}`, `{"a":2}`, `{"a":2}`, `{"a":2}`, nil},
+	{`{"a":1,"b":1}`, `{"a":2,"b":1}`, `{"a":3,"b":2}`, `{"a":1,"b":2}`, []string{"/a"}},
+	{`{"a":{"b":1,"c":1}}`, `{"a":{"b":2,"c":1}}`, `{"a":{"b":1,"c":2}}`, `{"a":{"b":2,"c":2}}`, nil},
+	{`{"a":{"b":1}}`, `{"a":5}`, `{"a":{"b":2}}`, `{"a":{"b":1}}`, []string{"/a"}},
+	{`{"a":{"b":1}}`, `{}`, `{"a":{"b":1,"c":2}}`, `{"a":{"b":1}}`, []string{"/a"}},
+	{`{"a":[1,2,3],"b":1}`, `{"a":[1,3],"b":1}`, `{"a":[1,2,3],"b":2}`, `{"a":[1,3],"b":2}`, nil},
+	{`{"a":[1,2,3]}`, `{"a":[1,3]}`, `{"a":[0,1,2,3]}`, `{"a":[1,2,3]}`, []string{"/a"}},
+	{`{"a":[{"b":1},{"c":1}]}`, `{"a":[{"b":2},{"c":1}]}`, `{"a":[{"b":2},{"c":1}]}`, `{"a":[{"b":2},{"c":1}]}`, nil},
+	{`{"a":1}`, `{"a":1,"x":1}`, `{"a":1,"x":2}`, `{"a":1}`, []string{"/x"}},
+	{`{"a":1,"b":1}`, `{"a":2,"b":2}`, `{"a":3,"b":3}`, `{"a":1,"b":1}`, []string{"/a", "/b"}},
+	{`[1]`, `{"a":1}`, `[1,2]`, `[1]`, []string{""}},
+	{`{"arr":[{"a":1,"b":2,"c":3,"d":4}]}`, `{"arr":[{"a":5,"b":6,"c":7,"d":8}]}`, `{"arr":[{"a":5,"b":6,"c":7,"d":8}]}`, `{"arr":[{"a":5,"b":6,"c":7,"d":8}]}`, nil},
+	{`{"a":{"b":1,"c":2}}`, `{}`, `{}`, `{}`, nil},
+}
+
+func TestThreeWayMerge(t *testing.T) {
+	for _, test := range threeWayTests {
+		res, conflicts, err := ThreeWayMerge([]byte(test.base), []byte(test.ours), []byte(test.theirs))
+		if err != nil {
+			t.Errorf("Merging `%v` and `%v` into `%v` failed: %v", test.ours, test.theirs, test.base, err)
+			continue
+		}
+		var got, want interface{}
+		utils.Unmarshal(res, &got)
+		utils.Unmarshal([]byte(test.result), &want)
+		if !Equal(got, want) {
+			t.Errorf("Merging `%v` and `%v` into `%v` gave `%v`, expected `%v`", test.ours, test.theirs, test.base, string(res), test.result)
+		}
+		paths := []string{}
+		for _, c := range conflicts {
+			paths = append(paths, c.Path.String())
+			if len(c.Ours) == 0 || len(c.Theirs) == 0 {
+				t.Errorf("Conflict at %v is missing ops from one side: %v, %v", c.Path, c.Ours, c.Theirs)
+			}
+		}
+		if len(paths) != len(test.conflicts) {
+			t.Errorf("Merging `%v` and `%v` into `%v` had conflicts %v, expected %v", test.ours, test.theirs, test.base, paths, test.conflicts)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != test.conflicts[i] {
+				t.Errorf("Merging `%v` and `%v` into `%v` had conflicts %v, expected %v", test.ours, test.theirs, test.base, paths, test.conflicts)
+				break
+			}
+		}
+	}
+}
+
+func TestThreeWayMergeConflictOps(t *testing.T) {
+	_, conflicts, err := ThreeWayMerge([]byte(`{"a":{"b":1}}`), []byte(`{"a":{"b":2}}`), []byte(`{"a":{"b":3}}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict, got %v", conflicts)
+	}
+	c := conflicts[0]
+	if c.Path.String() != "/a/b" || len(c.Ours) != 1 || len(c.Theirs) != 1 ||
+		!Equal(c.Ours[0].Value, 2) || !Equal(c.Theirs[0].Value, 3) {
+		t.Errorf("Conflict has the wrong ops: %#v", c)
+	}
+}
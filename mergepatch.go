@@ -0,0 +1,205 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+// MergePatchContentType is the media type of an RFC 7386 JSON Merge Patch.
+const MergePatchContentType = "application/merge-patch+json"
+
+// checkMergeable makes sure that val, which is about to be put into a
+// merge patch at ptr, has no object members that are null.  A merge
+// patch uses null to mean "remove this member", so it has no way to
+// set one to null.
+func checkMergeable(val interface{}, ptr Pointer) error {
+	switch t := val.(type) {
+	case map[string]interface{}:
+		for k, v := range t {
+			if v == nil {
+				return fmt.Errorf("Cannot set %v to null in a merge patch", ptr.Append(k))
+			}
+			if err := checkMergeable(v, ptr.Append(k)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeGen generates the merge patch that turns base into target.
+// Objects are diffed member by member, everything else (including
+// arrays) is replaced wholesale.
+func mergeGen(base, target interface{}, ptr Pointer) (interface{}, error) {
+	targetVal, ok := target.(map[string]interface{})
+	if !ok {
+		return utils.Clone(target), nil
+	}
+	baseVal, ok := base.(map[string]interface{})
+	if !ok {
+		return utils.Clone(target), checkMergeable(target, ptr)
+	}
+	res := make(map[string]interface{})
+	for k := range baseVal {
+		if _, ok := targetVal[k]; !ok {
+			res[k] = nil
+		}
+	}
+	for k, newVal := range targetVal {
+		oldVal, ok := baseVal[k]
+		if ok && Equal(oldVal, newVal) {
+			continue
+		}
+		if newVal == nil {
+			return nil, fmt.Errorf("Cannot set %v to null in a merge patch", ptr.Append(k))
+		}
+		if !ok {
+			oldVal = nil
+		}
+		sub, err := mergeGen(oldVal, newVal, ptr.Append(k))
+		if err != nil {
+			return nil, err
+		}
+		res[k] = sub
+	}
+	return res, nil
+}
+
+// GenerateMergePatch generates an RFC 7386 JSON Merge Patch that will
+// modify base into target.  Removed object members are set to null,
+// changed objects are recursed into, and anything else that changed
+// (including arrays) is included whole.  Since a merge patch cannot
+// set an object member to null, an error is returned if target needs
+// one.
+//
+// base and target must be byte arrays containing valid JSON
+func GenerateMergePatch(base, target []byte) ([]byte, error) {
+	var rawBase, rawTarget interface{}
+	if err := utils.Unmarshal(base, &rawBase); err != nil {
+		return nil, err
+	}
+	if err := utils.Unmarshal(target, &rawTarget); err != nil {
+		return nil, err
+	}
+	res, err := mergeGen(rawBase, rawTarget, make(Pointer, 0))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(res)
+}
+
+// mergeToPatch generates the ops that apply the merge patch changes
+// to base.  Objects in changes are recursed into as long as base has
+// an object in the same place, and everything else replaces what is
+// in base wholesale.
+func mergeToPatch(base, changes interface{}, ptr Pointer) Patch {
+	res := make(Patch, 0)
+	pstr := ptr.String()
+	changesVal, ok := changes.(map[string]interface{})
+	if !ok {
+		if !Equal(base, changes) {
+			res = append(res, Operation{"replace", pstr, "", utils.Clone(changes), ptr, nil, true})
+		}
+		return res
+	}
+	baseVal, ok := base.(map[string]interface{})
+	if !ok {
+		return append(res, Operation{"replace", pstr, "", utils.Merge(nil, changes), ptr, nil, true})
+	}
+	keys := make([]string, 0, len(changesVal))
+	for k := range changesVal {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		newPtr := ptr.Append(k)
+		newPstr := newPtr.String()
+		oldVal, found := baseVal[k]
+		switch newVal := changesVal[k]; {
+		case newVal == nil:
+			if found {
+				res = append(res, Operation{"remove", newPstr, "", nil, newPtr, nil, false})
+			}
+		case !found:
+			res = append(res, Operation{"add", newPstr, "", utils.Merge(nil, newVal), newPtr, nil, true})
+		default:
+			res = append(res, mergeToPatch(oldVal, newVal, newPtr)...)
+		}
+	}
+	return res
+}
+
+// MergeToPatch converts the RFC 7386 JSON Merge Patch mergePatch into
+// a JSON Patch that does the same thing to base.  The resulting patch
+// will only do the same thing as the merge patch when applied to base.
+//
+// base and mergePatch must be byte arrays containing valid JSON
+func MergeToPatch(base, mergePatch []byte) (Patch, error) {
+	var rawBase, rawMerge interface{}
+	if err := utils.Unmarshal(base, &rawBase); err != nil {
+		return nil, err
+	}
+	if err := utils.Unmarshal(mergePatch, &rawMerge); err != nil {
+		return nil, err
+	}
+	return mergeToPatch(rawBase, rawMerge, make(Pointer, 0)), nil
+}
+
+// checkNoIndex makes sure that p does not point at an array element
+// in doc, since a merge patch can only change arrays wholesale.
+func checkNoIndex(doc interface{}, p Pointer) error {
+	if len(p) == 0 {
+		return nil
+	}
+	parent, err := p[:len(p)-1].Get(doc)
+	if err != nil {
+		return err
+	}
+	if _, ok := parent.([]interface{}); ok {
+		return &InvalidOpError{newContext(p, len(p)-1), fmt.Sprintf("Cannot express array element %v in a merge patch", p)}
+	}
+	return nil
+}
+
+// ToMergePatch converts p into an RFC 7386 JSON Merge Patch that does
+// the same thing to base.  Since merge patches can only replace
+// arrays wholesale and cannot set anything to null, an error is
+// returned if any op other than a test refers to an array element,
+// or if the patched document has null object members that base does
+// not.  Test ops are checked against base, but have no equivalent in
+// the merge patch.
+//
+// base must be a byte array containing valid JSON
+func (p Patch) ToMergePatch(base []byte) ([]byte, error) {
+	var rawBase interface{}
+	if err := utils.Unmarshal(base, &rawBase); err != nil {
+		return nil, err
+	}
+	if err := p.fixPointers(); err != nil {
+		return nil, err
+	}
+	result := utils.Clone(rawBase)
+	for i, op := range p {
+		var err error
+		if op.Op != "test" {
+			err = checkNoIndex(result, op.path)
+			if err == nil && op.Op == "move" {
+				err = checkNoIndex(result, op.from)
+			}
+		}
+		if err == nil {
+			result, err = op.apply(result)
+		}
+		if err != nil {
+			return nil, withOp(err, op, i)
+		}
+	}
+	res, err := mergeGen(rawBase, result, make(Pointer, 0))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(res)
+}
@@ -0,0 +1,156 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+var mergeGenTests = []struct {
+	src, final, patch string
+}{
+	{`{"a":1}`, `{"a":1}`, `{}`},
+	{`{"a":1}`, `{"a":2}`, `{"a":2}`},
+	{`{"a":1,"b":2}`, `{"a":1}`, `{"b":null}`},
+	{`{"a":1}`, `{"a":1,"b":{"c":[1,2]}}`, `{"b":{"c":[1,2]}}`},
+	{`{"a":{"b":1,"c":2}}`, `{"a":{"b":1,"c":3,"d":4}}`, `{"a":{"c":3,"d":4}}`},
+	{`{"a":{"b":1}}`, `{"a":{}}`, `{"a":{"b":null}}`},
+	{`{"a":[1,2,3]}`, `{"a":[1,2]}`, `{"a":[1,2]}`},
+	{`{"a":[{"b":1}]}`, `{"a":[{"b":null}]}`, `{"a":[{"b":null}]}`},
+	{`{"a":5}`, `{"a":{"b":6}}`, `{"a":{"b":6}}`},
+	{`{"a":1.0}`, `{"a":1}`, `{}`},
+	{`{"a":null}`, `{"a":null}`, `{}`},
+	{`[1,2]`, `[1,2,3]`, `[1,2,3]`},
+	{`{"a":1}`, `"foo"`, `"foo"`},
+	{`"foo"`, `{"a":1}`, `{"a":1}`},
+}
+
+func TestGenerateMergePatch(t *testing.T) {
+	for _, test := range mergeGenTests {
+		patch, err := GenerateMergePatch([]byte(test.src), []byte(test.final))
+		if err != nil {
+			t.Errorf("Failed to generate merge patch from `%v` to `%v`: %v", test.src, test.final, err)
+			continue
+		}
+		var got, want interface{}
+		utils.Unmarshal(patch, &got)
+		utils.Unmarshal([]byte(test.patch), &want)
+		if !Equal(got, want) {
+			t.Errorf("Merge patch from `%v` to `%v` was `%v`, expected `%v`", test.src, test.final, string(patch), test.patch)
+			continue
+		}
+		res, err := utils.MergeJSON([]byte(test.src), patch)
+		if err != nil {
+			t.Errorf("Merge patch `%v` failed to apply to `%v`: %v", string(patch), test.src, err)
+			continue
+		}
+		utils.Unmarshal(res, &got)
+		utils.Unmarshal([]byte(test.final), &want)
+		if !Equal(got, want) {
+			t.Errorf("Merge patch `%v` turned `%v` into `%v`, not `%v`", string(patch), test.src, string(res), test.final)
+		}
+	}
+}
+
+func TestGenerateMergePatchNulls(t *testing.T) {
+	for _, test := range []struct{ src, final string }{
+		{`{"a":1}`, `{"a":null}`},
+		{`{}`, `{"a":null}`},
+		{`{"a":{"b":1}}`, `{"a":{"b":1,"c":null}}`},
+		{`[]`, `{"a":{"b":null}}`},
+	} {
+		if patch, err := GenerateMergePatch([]byte(test.src), []byte(test.final)); err == nil {
+			t.Errorf("Merge patch from `%v` to `%v` should have failed, got `%v`", test.src, test.final, string(patch))
+		}
+	}
+}
+
+// These are the test cases from Appendix A of RFC 7386.
+var mergeToPatchTests = []struct {
+	src, merge, final string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+}
+
+func TestMergeToPatch(t *testing.T) {
+	for _, test := range mergeToPatchTests {
+		patch, err := MergeToPatch([]byte(test.src), []byte(test.merge))
+		if err != nil {
+			t.Errorf("Failed to convert merge patch `%v`: %v", test.merge, err)
+			continue
+		}
+		buf, _ := json.Marshal(patch)
+		res, err, _ := patch.Apply([]byte(test.src))
+		if err != nil {
+			t.Errorf("Patch %v converted from `%v` failed to apply to `%v`: %v", string(buf), test.merge, test.src, err)
+			continue
+		}
+		var got, want interface{}
+		utils.Unmarshal(res, &got)
+		utils.Unmarshal([]byte(test.final), &want)
+		if !Equal(got, want) {
+			t.Errorf("Patch %v converted from `%v` turned `%v` into `%v`, not `%v`", string(buf), test.merge, test.src, string(res), test.final)
+		}
+	}
+}
+
+var toMergePatchTests = []struct {
+	src, patch, merge string
+	shouldPass        bool
+}{
+	{`{"a":1}`, `[{"op":"replace","path":"/a","value":2}]`, `{"a":2}`, true},
+	{`{"a":1,"b":2}`, `[{"op":"remove","path":"/b"},{"op":"add","path":"/c","value":{"d":[1]}}]`, `{"b":null,"c":{"d":[1]}}`, true},
+	{`{"a":{"b":1}}`, `[{"op":"move","from":"/a/b","path":"/c"}]`, `{"a":{"b":null},"c":1}`, true},
+	{`{"a":[1,2]}`, `[{"op":"copy","from":"/a/0","path":"/b"}]`, `{"b":1}`, true},
+	{`{"a":[1,2]}`, `[{"op":"test","path":"/a/0","value":1},{"op":"replace","path":"/a","value":[3]}]`, `{"a":[3]}`, true},
+	{`{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"remove","path":"/b"}]`, `{}`, true},
+	{`{"a":null}`, `[{"op":"add","path":"/b","value":1}]`, `{"b":1}`, true},
+	{`{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, ``, false},
+	{`{"a":[1,2]}`, `[{"op":"remove","path":"/a/0"}]`, ``, false},
+	{`{"a":[1,2]}`, `[{"op":"move","from":"/a/0","path":"/b"}]`, ``, false},
+	{`{"a":1}`, `[{"op":"replace","path":"/a","value":null}]`, ``, false},
+	{`{"a":1}`, `[{"op":"add","path":"/b","value":{"c":null}}]`, ``, false},
+	{`{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, ``, false},
+}
+
+func TestToMergePatch(t *testing.T) {
+	for _, test := range toMergePatchTests {
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			t.Errorf("Failed to parse patch %v: %v", test.patch, err)
+			continue
+		}
+		merge, err := patch.ToMergePatch([]byte(test.src))
+		if !test.shouldPass {
+			if err == nil {
+				t.Errorf("Converting %v against `%v` should have failed, got `%v`", test.patch, test.src, string(merge))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Failed to convert %v against `%v`: %v", test.patch, test.src, err)
+			continue
+		}
+		var got, want interface{}
+		utils.Unmarshal(merge, &got)
+		utils.Unmarshal([]byte(test.merge), &want)
+		if !Equal(got, want) {
+			t.Errorf("Converting %v against `%v` gave `%v`, expected `%v`", test.patch, test.src, string(merge), test.merge)
+		}
+	}
+}
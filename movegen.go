@@ -0,0 +1,195 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"hash"
+	"hash/fnv"
+	"sort"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+// hashValue feeds a JSON-ish value into h in a canonical form, so
+// that equal values always hash the same regardless of map ordering.
+func hashValue(h hash.Hash64, val interface{}) {
+	switch t := val.(type) {
+	case map[string]interface{}:
+		h.Write([]byte{'{'})
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			h.Write([]byte(k))
+			h.Write([]byte{0})
+			hashValue(h, t[k])
+		}
+		h.Write([]byte{'}'})
+	case []interface{}:
+		h.Write([]byte{'['})
+		for _, v := range t {
+			hashValue(h, v)
+		}
+		h.Write([]byte{']'})
+	case string:
+		h.Write([]byte{'"'})
+		h.Write([]byte(t))
+		h.Write([]byte{0})
+	case float64, json.Number:
+		// Numbers that are equal by value must hash the same no
+		// matter how they are written.
+		if n, ok := toRat(t); ok {
+			h.Write([]byte{'#'})
+			h.Write([]byte(n.RatString()))
+			h.Write([]byte{0})
+		}
+	case bool:
+		if t {
+			h.Write([]byte{'t'})
+		} else {
+			h.Write([]byte{'f'})
+		}
+	case nil:
+		h.Write([]byte{'n'})
+	}
+}
+
+func valueHash(val interface{}) uint64 {
+	h := fnv.New64a()
+	hashValue(h, val)
+	return h.Sum64()
+}
+
+// isCompound returns whether val is worth moving or copying instead
+// of just adding it again.  Scalars are not, as a move or copy op for
+// them is no smaller than the value itself.
+func isCompound(val interface{}) bool {
+	switch t := val.(type) {
+	case map[string]interface{}:
+		return len(t) > 0
+	case []interface{}:
+		return len(t) > 0
+	default:
+		return false
+	}
+}
+
+// objectPath returns whether every container ptr passes through in
+// doc is an object.  Values at such paths cannot be shifted around by
+// ops on arrays, so they stay put for the life of a generated patch.
+func objectPath(doc interface{}, ptr Pointer) bool {
+	for _, seg := range ptr {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		doc = m[string(seg)]
+	}
+	return true
+}
+
+type valueSource struct {
+	ptr  Pointer
+	val  interface{}
+	used bool
+}
+
+// copySources finds every compound value reachable from base via
+// object keys alone that is left unchanged in target.
+func copySources(base, target interface{}, ptr Pointer, res map[uint64][]*valueSource) {
+	baseVal, ok := base.(map[string]interface{})
+	if !ok {
+		return
+	}
+	targetVal, ok := target.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for k, oldVal := range baseVal {
+		newVal, ok := targetVal[k]
+		if !ok {
+			continue
+		}
+		newPtr := ptr.Append(k)
+		if isCompound(oldVal) && Equal(oldVal, newVal) {
+			h := valueHash(oldVal)
+			res[h] = append(res[h], &valueSource{ptr: newPtr, val: oldVal})
+		}
+		copySources(oldVal, newVal, newPtr, res)
+	}
+}
+
+func findSource(sources map[uint64][]*valueSource, val interface{}) *valueSource {
+	for _, src := range sources[valueHash(val)] {
+		if !src.used && Equal(src.val, val) {
+			return src
+		}
+	}
+	return nil
+}
+
+// moveGen rewrites a patch generated by basicGen to use move and copy
+// ops.  An add of a value that the patch removes elsewhere becomes a
+// move from where it was removed, and an add of a value that is left
+// unchanged elsewhere becomes a copy of it.
+//
+// Only values that live at object-only paths in base are considered
+// as sources, which keeps their paths valid no matter where in the
+// patch the move or copy lands.
+func moveGen(base, target interface{}, patch Patch, paranoid bool) Patch {
+	removed := make(map[uint64][]*valueSource)
+	removeAt := make(map[*valueSource][]int)
+	for i, op := range patch {
+		if op.Op != "remove" || !objectPath(base, op.path) {
+			continue
+		}
+		val, err := op.path.Get(base)
+		if err != nil || !isCompound(val) {
+			continue
+		}
+		src := &valueSource{ptr: op.path, val: val}
+		h := valueHash(val)
+		removed[h] = append(removed[h], src)
+		at := []int{i}
+		if i > 0 && patch[i-1].Op == "test" && patch[i-1].Path == op.Path {
+			at = append(at, i-1)
+		}
+		removeAt[src] = at
+	}
+	unchanged := make(map[uint64][]*valueSource)
+	copySources(base, target, Pointer{}, unchanged)
+	if len(removed) == 0 && len(unchanged) == 0 {
+		return patch
+	}
+	drop := make(map[int]struct{})
+	replace := make(map[int]Patch)
+	for i, op := range patch {
+		if op.Op != "add" || !isCompound(op.Value) {
+			continue
+		}
+		if src := findSource(removed, op.Value); src != nil {
+			src.used = true
+			for _, idx := range removeAt[src] {
+				drop[idx] = struct{}{}
+			}
+			from := src.ptr.String()
+			ops := make(Patch, 0, 2)
+			if paranoid {
+				ops = append(ops, Operation{"test", from, "", utils.Clone(src.val), src.ptr, nil, true})
+			}
+			replace[i] = append(ops, Operation{"move", op.Path, from, nil, op.path, src.ptr, false})
+		} else if src := findSource(unchanged, op.Value); src != nil {
+			replace[i] = Patch{{"copy", op.Path, src.ptr.String(), nil, op.path, src.ptr, false}}
+		}
+	}
+	res := make(Patch, 0, len(patch))
+	for i, op := range patch {
+		if ops, ok := replace[i]; ok {
+			res = append(res, ops...)
+		} else if _, ok := drop[i]; !ok {
+			res = append(res, op)
+		}
+	}
+	return res
+}
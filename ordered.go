@@ -0,0 +1,292 @@
+package jsonpatch2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// orderedKeys records the order of the keys in an object.  It holds
+// on to the object itself so that its address is not reused by
+// another one while the order is still being tracked.
+type orderedKeys struct {
+	m    map[string]interface{}
+	keys []string
+}
+
+// keyOrder tracks the key order of the objects in a document, so
+// that it can be kept through a patch being applied.
+type keyOrder map[uintptr]*orderedKeys
+
+func (o keyOrder) entry(m map[string]interface{}) *orderedKeys {
+	id := reflect.ValueOf(m).Pointer()
+	e, ok := o[id]
+	if !ok {
+		e = &orderedKeys{m: m}
+		o[id] = e
+	}
+	return e
+}
+
+func (o keyOrder) add(m map[string]interface{}, key string) {
+	e := o.entry(m)
+	for _, k := range e.keys {
+		if k == key {
+			return
+		}
+	}
+	e.keys = append(e.keys, key)
+}
+
+func (o keyOrder) drop(m map[string]interface{}, key string) {
+	e := o.entry(m)
+	for i, k := range e.keys {
+		if k == key {
+			e.keys = append(e.keys[:i], e.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// copyOrder gives the objects in dst, which is a copy of src, the
+// same key order as the ones in src.
+func (o keyOrder) copyOrder(src, dst interface{}) {
+	// src may have changed since dst was copied from it if dst is
+	// inside src, so only follow what they still have in common.
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			return
+		}
+		o.entry(d).keys = append([]string{}, o.entry(s).keys...)
+		for k, v := range s {
+			if dv, ok := d[k]; ok {
+				o.copyOrder(v, dv)
+			}
+		}
+	case []interface{}:
+		d, ok := dst.([]interface{})
+		if !ok {
+			return
+		}
+		for i := 0; i < len(s) && i < len(d); i++ {
+			o.copyOrder(s[i], d[i])
+		}
+	}
+}
+
+// decode reads the next value from dec like utils.Unmarshal would,
+// recording the key order of all the objects in it.
+func (o keyOrder) decode(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := map[string]interface{}{}
+		e := o.entry(m)
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := o.decode(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := m[key.(string)]; !ok {
+				e.keys = append(e.keys, key.(string))
+			}
+			m[key.(string)] = val
+		}
+		_, err = dec.Token()
+		return m, err
+	case json.Delim('['):
+		s := []interface{}{}
+		for dec.More() {
+			val, err := o.decode(dec)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, val)
+		}
+		_, err = dec.Token()
+		return s, err
+	}
+	return tok, nil
+}
+
+func (o keyOrder) unmarshal(buf []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	res, err := o.decode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid data after top-level JSON value")
+	}
+	return res, nil
+}
+
+// marshal writes v to buf with the keys of every object in their
+// recorded order.  Keys with no recorded order come last, sorted.
+func (o keyOrder) marshal(buf *bytes.Buffer, v interface{}) error {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		done := make(map[string]bool, len(t))
+		if e, ok := o[reflect.ValueOf(t).Pointer()]; ok {
+			for _, k := range e.keys {
+				if _, ok := t[k]; ok && !done[k] {
+					keys = append(keys, k)
+					done[k] = true
+				}
+			}
+		}
+		rest := make([]string, 0, len(t)-len(keys))
+		for k := range t {
+			if !done[k] {
+				rest = append(rest, k)
+			}
+		}
+		sort.Strings(rest)
+		buf.WriteByte('{')
+		for i, k := range append(keys, rest...) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(k)
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := o.marshal(buf, t[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i := range t {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := o.marshal(buf, t[i]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		res, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(res)
+	}
+	return nil
+}
+
+// parentObject returns the object p is a member of in doc, if it is one.
+func parentObject(doc interface{}, p Pointer) (map[string]interface{}, string) {
+	if len(p) == 0 {
+		return nil, ""
+	}
+	key, parent := p.Chop()
+	container, _ := parent.Get(doc)
+	m, _ := container.(map[string]interface{})
+	return m, key
+}
+
+// applyOrdered applies p directly to doc, keeping track of the key
+// order of objects as they change.  New keys go at the end.
+func (p Patch) applyOrdered(doc interface{}, order keyOrder, opts ApplyOptions) (result interface{}, err error, loc int) {
+	for i := range p {
+		op := &p[i]
+		if err = op.validate(doc, opts); err != nil {
+			return doc, withOp(err, *op, i), i
+		}
+		var removedFrom map[string]interface{}
+		var removedKey string
+		switch op.Op {
+		case "remove":
+			removedFrom, removedKey = parentObject(doc, op.path)
+		case "move":
+			if op.from.String() != op.path.String() {
+				removedFrom, removedKey = parentObject(doc, op.from)
+			}
+		}
+		if doc, err = op.apply(doc); err != nil {
+			return doc, withOp(err, *op, i), i
+		}
+		if removedFrom != nil {
+			order.drop(removedFrom, removedKey)
+		}
+		switch op.Op {
+		case "add", "copy", "move":
+			if m, key := parentObject(doc, op.path); m != nil {
+				order.add(m, key)
+			}
+		}
+		if op.Op == "copy" {
+			src, _ := op.from.Get(doc)
+			dst, _ := op.path.Get(doc)
+			order.copyOrder(src, dst)
+		}
+	}
+	return doc, nil, 0
+}
+
+// layout is how a document was laid out.
+type layout struct {
+	// indent is the indentation used for nested values, or "" if
+	// the document is all on one line.
+	indent string
+	// newline is the line ending used.
+	newline string
+	// trailing is set if the document ends with a line ending.
+	trailing bool
+}
+
+// detectLayout works out how buf was laid out.  The indentation is
+// taken from the first indented line.
+func detectLayout(buf []byte) layout {
+	res := layout{newline: "\n"}
+	if bytes.Contains(buf, []byte("\r\n")) {
+		res.newline = "\r\n"
+	}
+	res.trailing = bytes.HasSuffix(bytes.TrimRight(buf, " \t"), []byte("\n"))
+	lines := bytes.Split(buf, []byte("\n"))
+	for _, line := range lines[1:] {
+		rest := bytes.TrimLeft(line, " \t")
+		if len(rest) != len(line) && len(bytes.TrimSpace(rest)) > 0 {
+			res.indent = string(line[:len(line)-len(rest)])
+			break
+		}
+	}
+	return res
+}
+
+// reformat lays buf out the same way as orig.
+func reformat(buf, orig []byte) ([]byte, error) {
+	l := detectLayout(orig)
+	if l.indent != "" {
+		var res bytes.Buffer
+		if err := json.Indent(&res, buf, "", l.indent); err != nil {
+			return nil, err
+		}
+		buf = res.Bytes()
+		if l.newline != "\n" {
+			// Strings in JSON cannot hold a raw newline, so every
+			// newline here is one json.Indent added.
+			buf = bytes.ReplaceAll(buf, []byte("\n"), []byte(l.newline))
+		}
+	}
+	if l.trailing {
+		buf = append(buf, l.newline...)
+	}
+	return buf, nil
+}
@@ -0,0 +1,81 @@
+package jsonpatch2
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+var orderedTests = []struct {
+	src, patch, final string
+}{
+	{`{"z":1,"a":2,"m":3}`, `[{"op":"replace","path":"/a","value":5}]`, `{"z":1,"a":5,"m":3}`},
+	{`{"z":1,"a":2,"m":3}`, `[{"op":"add","path":"/b","value":4}]`, `{"z":1,"a":2,"m":3,"b":4}`},
+	{`{"z":1,"a":2,"m":3}`, `[{"op":"add","path":"/z","value":4}]`, `{"z":4,"a":2,"m":3}`},
+	{`{"z":1,"a":2,"m":3}`, `[{"op":"remove","path":"/a"},{"op":"add","path":"/a","value":2}]`, `{"z":1,"m":3,"a":2}`},
+	{`{"z":{"y":1,"x":2},"a":[{"q":1,"p":2}]}`, `[{"op":"add","path":"/a/0/o","value":3}]`, `{"z":{"y":1,"x":2},"a":[{"q":1,"p":2,"o":3}]}`},
+	{`{"z":{"y":1,"x":2},"a":[]}`, `[{"op":"copy","from":"/z","path":"/c"}]`, `{"z":{"y":1,"x":2},"a":[],"c":{"y":1,"x":2}}`},
+	{`{"z":{"y":1,"x":2},"a":[]}`, `[{"op":"move","from":"/z","path":"/a/0"}]`, `{"a":[{"y":1,"x":2}]}`},
+	{`{"z":{"y":1,"x":2},"a":1}`, `[{"op":"move","from":"/z","path":"/z"}]`, `{"z":{"y":1,"x":2},"a":1}`},
+	{`{"b":1}`, `[{"op":"add","path":"/a","value":{"z":1,"y":2}}]`, `{"b":1,"a":{"y":2,"z":1}}`},
+	{`{"b":{"d":1,"c":2}}`, `[{"op":"copy","from":"/b","path":"/b/a"}]`, `{"b":{"d":1,"c":2,"a":{"d":1,"c":2}}}`},
+}
+
+func TestOrderedPatches(t *testing.T) {
+	for _, test := range orderedTests {
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			t.Fatalf("Bad patch %v: %v", test.patch, err)
+		}
+		res, err, _ := patch.ApplyWithOptions([]byte(test.src), ApplyOptions{PreserveOrder: true})
+		if err != nil {
+			t.Errorf("Applying %v to `%v` failed: %v", test.patch, test.src, err)
+			continue
+		}
+		if string(res) != test.final {
+			t.Errorf("Applying %v to `%v` gave `%v`, expected `%v`", test.patch, test.src, string(res), test.final)
+		}
+	}
+}
+
+func TestPreserveIndent(t *testing.T) {
+	patch, _ := NewPatch([]byte(`[{"op":"replace","path":"/b","value":2},{"op":"add","path":"/a/-","value":2}]`))
+	for _, test := range []struct {
+		src, final string
+	}{
+		{"{\n  \"b\": 1,\n  \"a\": [\n    1\n  ]\n}\n", "{\n  \"b\": 2,\n  \"a\": [\n    1,\n    2\n  ]\n}\n"},
+		{"{\n\t\"b\": 1,\n\t\"a\": [1]\n}", "{\n\t\"b\": 2,\n\t\"a\": [\n\t\t1,\n\t\t2\n\t]\n}"},
+		{`{"b":1,"a":[1]}`, `{"b":2,"a":[1,2]}`},
+		{"{\"b\":1,\"a\":[1]}\n", "{\"b\":2,\"a\":[1,2]}\n"},
+		{"{\r\n  \"b\": 1,\r\n  \"a\": [1]\r\n}\r\n", "{\r\n  \"b\": 2,\r\n  \"a\": [\r\n    1,\r\n    2\r\n  ]\r\n}\r\n"},
+		{"{\r\n  \"b\": 1,\r\n  \"a\": [1]\r\n}", "{\r\n  \"b\": 2,\r\n  \"a\": [\r\n    1,\r\n    2\r\n  ]\r\n}"},
+		{"\n{\n   \"b\": 1,\n   \"a\": [1]\n}\n", "{\n   \"b\": 2,\n   \"a\": [\n      1,\n      2\n   ]\n}\n"},
+	} {
+		res, err, _ := patch.ApplyWithOptions([]byte(test.src), ApplyOptions{PreserveOrder: true, PreserveIndent: true})
+		if err != nil {
+			t.Errorf("Applying patch to %q failed: %v", test.src, err)
+			continue
+		}
+		if string(res) != test.final {
+			t.Errorf("Applying patch to %q gave %q, expected %q", test.src, string(res), test.final)
+		}
+	}
+}
+
+func TestOrderedMatchesApply(t *testing.T) {
+	checkMatchesApply(t, "Applying in order", func(patch Patch, base interface{}) (interface{}, error, int) {
+		src, _ := json.Marshal(base)
+		res, err, loc := patch.ApplyWithOptions(src, ApplyOptions{PreserveOrder: true})
+		if err != nil {
+			return nil, err, loc
+		}
+		// Sorted input stays sorted when nothing new is added.
+		if len(patch) == 0 && !bytes.Equal(res, src) {
+			t.Errorf("Empty patch changed %v to %v", string(src), string(res))
+		}
+		var got interface{}
+		return got, utils.Unmarshal(res, &got), loc
+	})
+}
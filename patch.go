@@ -12,6 +12,7 @@ package jsonpatch2
 // See http://tools.ietf.org/html/rfc6902 for more information.
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
@@ -36,8 +37,13 @@ type Operation struct {
 	// copied/moved from.  From is only used by copy and move operations.
 	From string `json:"from"`
 	// Value is the Value to be used for add, replace, and test operations.
+	// A nil Value means JSON null.
 	Value      interface{} `json:"value"`
 	path, from Pointer
+	// hasValue records whether an add, replace, or test operation
+	// was unmarshalled with a value member, which lets NewPatch tell
+	// a missing value apart from an explicit null.
+	hasValue bool
 }
 
 func (o *Operation) fixPointers() error {
@@ -59,16 +65,28 @@ func (o *Operation) fixPointers() error {
 
 func (o *Operation) UnmarshalJSON(buf []byte) error {
 	type op struct {
-		Op    string      `json:"op"`
-		Path  string      `json:"path"`
-		From  string      `json:"from"`
-		Value interface{} `json:"value"`
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		From  string          `json:"from"`
+		Value json.RawMessage `json:"value"`
 	}
 	ref := op{}
-	if err := json.Unmarshal(buf, &ref); err != nil {
+	if err := utils.Unmarshal(buf, &ref); err != nil {
 		return err
 	}
-	o.Op, o.Path, o.From, o.Value = ref.Op, ref.Path, ref.From, ref.Value
+	o.Op, o.Path, o.From, o.Value = ref.Op, ref.Path, ref.From, nil
+	// A value member of null still unmarshals to a non-nil RawMessage.
+	if ref.Value != nil {
+		if err := utils.Unmarshal(ref.Value, &o.Value); err != nil {
+			return err
+		}
+	}
+	switch o.Op {
+	case "test", "replace", "add":
+		o.hasValue = ref.Value != nil
+	default:
+		o.hasValue = false
+	}
 	return o.fixPointers()
 }
 
@@ -76,13 +94,15 @@ const ContentType = "application/json-patch+json"
 
 // Apply performs a single patch operation
 func (o *Operation) apply(to interface{}) (interface{}, error) {
+	// Values are cloned so that later ops cannot change the patch
+	// through the document.
 	switch o.Op {
 	case "test":
 		return to, o.path.Test(to, o.Value)
 	case "replace":
-		return o.path.Replace(to, o.Value)
+		return o.path.Replace(to, utils.Clone(o.Value))
 	case "add":
-		return o.path.Put(to, o.Value)
+		return o.path.Put(to, utils.Clone(o.Value))
 	case "remove":
 		return o.path.Remove(to)
 	case "move":
@@ -90,7 +110,7 @@ func (o *Operation) apply(to interface{}) (interface{}, error) {
 	case "copy":
 		return o.from.Copy(to, o.path)
 	default:
-		return to, fmt.Errorf("Invalid op %v", o.Op)
+		return to, &InvalidOpError{ErrorContext{Path: o.path}, fmt.Sprintf("Invalid op %v", o.Op)}
 	}
 }
 
@@ -103,41 +123,143 @@ func NewPatch(buf []byte) (res Patch, err error) {
 	if err = json.Unmarshal(buf, &res); err != nil {
 		return nil, err
 	}
+	return res, res.check()
+}
 
-	for _, op := range res {
-		if op.path == nil {
-			return res, fmt.Errorf("Did not get valid path")
-		}
-		switch op.Op {
-		case "test", "replace", "add":
-			if op.Value == nil {
-				return res, fmt.Errorf("%v must have a valid value", op.Op)
-
+// check makes sure that every op in p has what its Op needs.
+func (p Patch) check() error {
+	for i, op := range p {
+		var reason string
+		switch {
+		case op.path == nil:
+			reason = "Did not get valid path"
+		case op.Op == "test", op.Op == "replace", op.Op == "add":
+			if !op.hasValue {
+				reason = fmt.Sprintf("%v must have a value", op.Op)
 			}
-		case "move", "copy":
+		case op.Op == "move", op.Op == "copy":
 			if op.from == nil {
-				return res, fmt.Errorf("%v must have a from", op.Op)
+				reason = fmt.Sprintf("%v must have a from", op.Op)
 			}
-		case "remove":
-			continue
+		case op.Op == "remove":
 		default:
-			return res, fmt.Errorf("%v is not a valid JSON Patch operator", op.Op)
+			reason = fmt.Sprintf("%v is not a valid JSON Patch operator", op.Op)
+		}
+		if reason != "" {
+			return withOp(&InvalidOpError{ErrorContext{Path: op.path}, reason}, op, i)
 		}
 	}
-	return res, nil
+	return nil
+}
+
+// ApplyOptions controls how patches are applied.
+type ApplyOptions struct {
+	// Strict makes array indexes follow RFC 6901 exactly, so only
+	// decimal indexes without leading zeros (and "-" as the last
+	// segment of a pointer) are allowed.
+	Strict bool
+	// NegativeIndexes allows negative array indexes that count back
+	// from the end of the array even when Strict is set.  They are
+	// always allowed when Strict is not set.
+	NegativeIndexes bool
+	// InPlace applies the patch directly to the document instead of
+	// to a copy of it, so that only the parts of the document the
+	// patch touches are copied.  Each op records how to undo itself,
+	// and if an op fails the ones before it are undone so the
+	// document is left as it was.
+	InPlace bool
+	// ShareUnchanged leaves the document alone and applies the patch
+	// by copying only the containers along the paths of its ops, so
+	// that the result shares everything the patch does not change
+	// with the original.  Neither should be modified afterwards
+	// unless the other is no longer needed.  InPlace takes precedence
+	// over ShareUnchanged.
+	ShareUnchanged bool
+	// PreserveOrder keeps the keys of objects in the order they were
+	// in, instead of sorting them.  Keys added by the patch go at the
+	// end of their object.  It only affects ApplyWithOptions.
+	PreserveOrder bool
+	// PreserveIndent indents the result the same way the document
+	// was indented, instead of putting it all on one line.  It only
+	// affects ApplyWithOptions.
+	PreserveIndent bool
+	// PreserveBytes leaves every byte of the document that the patch
+	// does not change exactly as it was, splicing newly encoded values
+	// in only where ops put them.  Values that are moved or copied
+	// keep their original bytes.  It only affects ApplyWithOptions,
+	// and takes precedence over PreserveOrder and PreserveIndent.
+	PreserveBytes bool
 }
 
-func (p Patch) apply(base interface{}) (result interface{}, err error, loc int) {
+// validate checks the pointers in o against doc.
+func (o *Operation) validate(doc interface{}, opts ApplyOptions) error {
+	if err := o.path.Validate(doc, opts); err != nil {
+		return err
+	}
+	switch o.Op {
+	case "move", "copy":
+		return o.from.Validate(doc, opts)
+	}
+	return nil
+}
+
+func (p Patch) apply(base interface{}, opts ApplyOptions) (result interface{}, err error, loc int) {
+	if opts.InPlace {
+		return p.applyInPlace(base, opts)
+	}
+	if opts.ShareUnchanged {
+		return p.applyShared(base, opts)
+	}
 	result = utils.Clone(base)
 	for i, op := range p {
+		if err = op.validate(result, opts); err != nil {
+			return result, withOp(err, op, i), i
+		}
 		result, err = op.apply(result)
 		if err != nil {
-			return result, err, i
+			return result, withOp(err, op, i), i
 		}
 	}
 	return result, nil, 0
 }
 
+// applyInPlace applies p directly to doc, undoing the ops that were
+// applied if one of them fails.  The undo ops are applied in reverse
+// order, so each one sees its values as they were when it was made
+// and they do not need to be copied.
+func (p Patch) applyInPlace(doc interface{}, opts ApplyOptions) (result interface{}, err error, loc int) {
+	undo := make([]Patch, 0, len(p))
+	for i := range p {
+		var inv Patch
+		if err = p[i].validate(doc, opts); err == nil {
+			if p[i].Op == "test" {
+				err = p[i].path.Test(doc, p[i].Value)
+			} else {
+				inv, doc, err = p[i].invert(doc)
+				undo = append(undo, inv)
+			}
+		}
+		if err != nil {
+			for j := len(undo) - 1; j >= 0; j-- {
+				for _, u := range undo[j] {
+					// Put the original values back as they are
+					// instead of copies of them.
+					switch u.Op {
+					case "add":
+						doc, _ = u.path.Put(doc, u.Value)
+					case "replace":
+						doc, _ = u.path.Replace(doc, u.Value)
+					default:
+						doc, _ = u.apply(doc)
+					}
+				}
+			}
+			return doc, withOp(err, p[i], i), i
+		}
+	}
+	return doc, nil, 0
+}
+
 func (p Patch) fixPointers() error {
 	if len(p) > 0 && p[0].path == nil {
 		for i := range p {
@@ -152,23 +274,67 @@ func (p Patch) fixPointers() error {
 // Apply applies p to base (which must be a byte array containing
 // valid JSON), yielding result (which will also be a byte array
 // containing valid JSON).  If err is returned, the returned int is
-// the index of the operation that failed.
-
-// ApplyJSON does the same thing as Apply, except the inputs should be
-// JSON-containing byte arrays instead of unmarshalled JSON
+// the index of the operation that failed.  Errors from failed
+// operations will be one of TestFailedError, PathNotFoundError,
+// IndexOutOfRangeError, or InvalidOpError, with their ErrorContext
+// filled in.
 func (p Patch) Apply(base []byte) (result []byte, err error, loc int) {
-	var rawBase interface{}
-	err = json.Unmarshal(base, &rawBase)
+	return p.ApplyWithOptions(base, ApplyOptions{})
+}
+
+// ApplyWithOptions does the same thing as Apply, with its behaviour
+// controlled by opts.
+func (p Patch) ApplyWithOptions(base []byte, opts ApplyOptions) (result []byte, err error, loc int) {
+	if opts.PreserveBytes {
+		if err := p.fixPointers(); err != nil {
+			return nil, err, 0
+		}
+		return p.applySpliced(base, opts)
+	}
+	var rawBase, rawRes interface{}
+	order := keyOrder{}
+	if opts.PreserveOrder {
+		rawBase, err = order.unmarshal(base)
+	} else {
+		err = utils.Unmarshal(base, &rawBase)
+	}
 	if err != nil {
 		return nil, err, 0
 	}
 	if err := p.fixPointers(); err != nil {
 		return nil, err, 0
 	}
-	rawRes, err, loc := p.apply(rawBase)
+	if opts.PreserveOrder {
+		rawRes, err, loc = p.applyOrdered(rawBase, order, opts)
+	} else {
+		rawRes, err, loc = p.apply(rawBase, opts)
+	}
 	if err != nil {
 		return nil, err, loc
 	}
-	result, err = json.Marshal(rawRes)
+	if opts.PreserveOrder {
+		var buf bytes.Buffer
+		err = order.marshal(&buf, rawRes)
+		result = buf.Bytes()
+	} else {
+		result, err = json.Marshal(rawRes)
+	}
+	if err == nil && opts.PreserveIndent {
+		result, err = reformat(result, base)
+	}
 	return result, err, loc
 }
+
+// ApplyDocument applies p to doc, which must be unmarshalled JSON of
+// the sort utils.Unmarshal produces.  doc is left alone unless
+// opts.InPlace is set, in which case it is modified directly and
+// result must be used in its place afterwards, even if err is
+// returned, since changing arrays can reallocate them.  When err is
+// returned, the returned int is the index of the operation that
+// failed, and with opts.InPlace result holds the restored document.
+func (p Patch) ApplyDocument(doc interface{}, opts ApplyOptions) (result interface{}, err error, loc int) {
+	if err = p.fixPointers(); err != nil {
+		return doc, err, 0
+	}
+	return p.apply(doc, opts)
+}
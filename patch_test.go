@@ -2,8 +2,11 @@ package jsonpatch2
 
 import (
 	"encoding/json"
+	"errors"
 	"reflect"
 	"testing"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
 )
 
 type opTest struct {
@@ -213,7 +216,7 @@ var opTests = []opTest{
 		`[{"op":"add","path":"/foo/-","value":6}]`,
 		true,
 		0,
-		false,
+		true,
 	},
 	{
 		`Array document add test 2`,
@@ -231,7 +234,7 @@ var opTests = []opTest{
 		`[{"op":"remove","path":"/foo/0"}]`,
 		true,
 		0,
-		false,
+		true,
 	},
 	{
 		`Array document add test 4`,
@@ -240,7 +243,7 @@ var opTests = []opTest{
 		`[{"op":"add","path":"/foo/0","value":6}]`,
 		true,
 		0,
-		false,
+		true,
 	},
 	{
 		`Array document add test 5`,
@@ -249,8 +252,53 @@ var opTests = []opTest{
 		`[{"op":"add","path":"/foo/1","value":6}]`,
 		true,
 		0,
+		true,
+	},
+	{
+		`Array document add test 6`,
+		`{"foo":["bar",5]}`,
+		`{"foo":["bar",5,6]}`,
+		`[{"op":"add","path":"/foo/2","value":6}]`,
+		true,
+		0,
 		false,
 	},
+	{
+		`Array document add test 7`,
+		`{"foo":["bar",5]}`,
+		`{"foo":["bar",5]}`,
+		`[{"op":"add","path":"/foo/3","value":6}]`,
+		false,
+		0,
+		false,
+	},
+	{
+		`Array element replace test 1`,
+		`{"foo":[1,2,3]}`,
+		`{"foo":[1,4,3]}`,
+		`[{"op":"replace","path":"/foo/1","value":4}]`,
+		true,
+		0,
+		true,
+	},
+	{
+		`Array element remove test 1`,
+		`{"foo":[1,2,3]}`,
+		`{"foo":[1,3]}`,
+		`[{"op":"remove","path":"/foo/1"}]`,
+		true,
+		0,
+		true,
+	},
+	{
+		`Array nested object test 1`,
+		`{"foo":[{"a":1},{"b":2}]}`,
+		`{"foo":[{"a":1},{"b":3}]}`,
+		`[{"op":"replace","path":"/foo/1/b","value":3}]`,
+		true,
+		0,
+		true,
+	},
 	// Top-level array adding and removing
 	{
 		`Top-level array document add test 1`,
@@ -259,7 +307,7 @@ var opTests = []opTest{
 		`[{"op":"add","path":"/-","value":6}]`,
 		true,
 		0,
-		false,
+		true,
 	},
 	{
 		`Top-level array document add test 2`,
@@ -357,6 +405,143 @@ var opTests = []opTest{
 		0,
 		false,
 	},
+	{
+		`Move test 4`,
+		`{"foo":{"bar":5}}`,
+		`{"foo":{"bar":5}}`,
+		`[{"op":"move","from":"/foo","path":"/foo"}]`,
+		true,
+		0,
+		false,
+	},
+	{
+		`Move test 5`,
+		`{"foo":[1,2,3]}`,
+		`{"foo":[1,2,3]}`,
+		`[{"op":"move","from":"/foo/1","path":"/foo/1"}]`,
+		true,
+		0,
+		false,
+	},
+	{
+		`Move test 6`,
+		`{"foo":[1,2,3],"bar":[4]}`,
+		`{"foo":[1,3],"bar":[4,2]}`,
+		`[{"op":"move","from":"/foo/1","path":"/bar/1"}]`,
+		true,
+		0,
+		false,
+	},
+	{
+		`Move test 7`,
+		`{"foo":[1,2,3,4]}`,
+		`{"foo":[2,3,1,4]}`,
+		`[{"op":"move","from":"/foo/0","path":"/foo/2"}]`,
+		true,
+		0,
+		false,
+	},
+	{
+		`Move test 8`,
+		`{"foo":[1,2,3]}`,
+		`{"foo":[1,2,3]}`,
+		`[{"op":"move","from":"/foo/2","path":"/foo/2"}]`,
+		true,
+		0,
+		false,
+	},
+	{
+		`Move test 9`,
+		`{"foo":[1,2,3]}`,
+		`{"foo":[3,1,2]}`,
+		`[{"op":"move","from":"/foo/2","path":"/foo/0"}]`,
+		true,
+		0,
+		false,
+	},
+	{
+		`Move test 10`,
+		`{"foo":{"bar":[1]}}`,
+		`{"foo":{"bar":[1]}}`,
+		`[{"op":"test","path":"/foo/bar/0","value":1},{"op":"move","from":"/foo","path":"/foo/bar/1"}]`,
+		false,
+		1,
+		false,
+	},
+	// Explicit null values
+	{
+		`Null add test 1`,
+		`{"foo":5}`,
+		`{"foo":5,"bar":null}`,
+		`[{"op":"add","path":"/bar","value":null}]`,
+		true,
+		0,
+		true,
+	},
+	{
+		`Null replace test 1`,
+		`{"foo":5}`,
+		`{"foo":null}`,
+		`[{"op":"replace","path":"/foo","value":null}]`,
+		true,
+		0,
+		true,
+	},
+	{
+		`Null test test 1`,
+		`{"foo":null}`,
+		`{"foo":null}`,
+		`[{"op":"test","path":"/foo","value":null}]`,
+		true,
+		0,
+		false,
+	},
+	{
+		`Null test test 2`,
+		`{"foo":5}`,
+		`{"foo":5}`,
+		`[{"op":"test","path":"/foo","value":null}]`,
+		false,
+		0,
+		false,
+	},
+	// Number precision and equality
+	{
+		`Number equality test 1`,
+		`{"foo":1}`,
+		`{"foo":1}`,
+		`[{"op":"test","path":"/foo","value":1.0}]`,
+		true,
+		0,
+		false,
+	},
+	{
+		`Number equality test 2`,
+		`{"foo":[100]}`,
+		`{"foo":[100]}`,
+		`[{"op":"test","path":"/foo","value":[1e2]}]`,
+		true,
+		0,
+		false,
+	},
+	{
+		`Number equality test 3`,
+		`{"foo":9007199254740993}`,
+		`{"foo":9007199254740993}`,
+		`[{"op":"test","path":"/foo","value":9007199254740992}]`,
+		false,
+		0,
+		false,
+	},
+	{
+		`Number precision test 1`,
+		`{"foo":9007199254740993}`,
+		`{"foo":9007199254740995}`,
+		`[{"op":"replace","path":"/foo","value":9007199254740995}]`,
+		true,
+		0,
+		true,
+	},
 	// Replace tests
 	{
 		`Replace test 1`,
@@ -490,6 +675,87 @@ func runTest(t *testing.T, test *opTest, full bool) {
 	}
 }
 
+func TestNumberPrecision(t *testing.T) {
+	src := []byte(`{"id":18446744073709551615,"list":[12345678901234567890]}`)
+	patch, _ := NewPatch([]byte(`[{"op":"copy","from":"/id","path":"/list/-"},{"op":"add","path":"/big","value":123456789012345678901234567890}]`))
+	res, err, _ := patch.Apply(src)
+	if err != nil {
+		t.Fatalf("Failed to apply patch: %v", err)
+	}
+	want := `{"big":123456789012345678901234567890,"id":18446744073709551615,"list":[12345678901234567890,18446744073709551615]}`
+	if string(res) != want {
+		t.Errorf("Expected `%v`, got `%v`", want, string(res))
+	}
+	gen, err := Generate([]byte(`{"a":1.0,"b":9007199254740993}`), []byte(`{"a":1,"b":9007199254740992}`), false)
+	if err != nil {
+		t.Fatalf("Failed to generate patch: %v", err)
+	}
+	buf, _ := json.Marshal(gen)
+	if string(buf) != `[{"op":"replace","path":"/b","from":"","value":9007199254740992}]` {
+		t.Errorf("Unexpected generated patch %v", string(buf))
+	}
+}
+
+func TestPatchValues(t *testing.T) {
+	for _, op := range []string{"add", "replace", "test"} {
+		if _, err := NewPatch([]byte(`[{"op":"` + op + `","path":"/foo"}]`)); err == nil {
+			t.Errorf("%v without a value should not make a Patch", op)
+		}
+		patch, err := NewPatch([]byte(`[{"op":"` + op + `","path":"/foo","value":null}]`))
+		if err != nil {
+			t.Errorf("%v with a null value should make a Patch: %v", op, err)
+			continue
+		}
+		buf, err := json.Marshal(patch)
+		if err != nil {
+			t.Errorf("Failed to marshal %v patch: %v", op, err)
+			continue
+		}
+		again, err := NewPatch(buf)
+		if err != nil {
+			t.Errorf("Marshalled %v patch `%v` did not round trip: %v", op, string(buf), err)
+		} else if !reflect.DeepEqual(patch, again) {
+			t.Errorf("Marshalled %v patch `%v` changed in the round trip", op, string(buf))
+		}
+	}
+	gen, _ := Generate([]byte(`{"a":1,"b":[1]}`), []byte(`{"a":null,"b":[null]}`), true)
+	buf, _ := json.Marshal(gen)
+	if _, err := NewPatch(buf); err != nil {
+		t.Errorf("Generated patch `%v` with nulls did not round trip: %v", string(buf), err)
+	}
+}
+
+func TestStrictPatches(t *testing.T) {
+	src := []byte(`{"foo":[1,2,3]}`)
+	for _, test := range []struct {
+		patch    string
+		negative bool
+		pass     bool
+	}{
+		{`[{"op":"remove","path":"/foo/1"}]`, false, true},
+		{`[{"op":"add","path":"/foo/-","value":4}]`, false, true},
+		{`[{"op":"remove","path":"/foo/01"}]`, false, false},
+		{`[{"op":"remove","path":"/foo/-1"}]`, false, false},
+		{`[{"op":"remove","path":"/foo/-1"}]`, true, true},
+		{`[{"op":"copy","from":"/foo/00","path":"/bar"}]`, false, false},
+		{`[{"op":"test","path":"/foo/1","value":2},{"op":"test","path":"/foo/+1","value":2}]`, false, false},
+	} {
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			t.Fatalf("Failed to make a Patch from `%v`: %v", test.patch, err)
+		}
+		if _, err, _ := patch.Apply(src); err != nil && test.pass {
+			t.Errorf("`%v` failed in non-strict mode: %v", test.patch, err)
+		}
+		_, err, _ = patch.ApplyWithOptions(src, ApplyOptions{Strict: true, NegativeIndexes: test.negative})
+		if test.pass && err != nil {
+			t.Errorf("`%v` failed in strict mode: %v", test.patch, err)
+		} else if !test.pass && err == nil {
+			t.Errorf("`%v` passed in strict mode", test.patch)
+		}
+	}
+}
+
 func TestPatches(t *testing.T) {
 	for _, test := range opTests {
 		runTest(t, &test, false)
@@ -577,3 +843,202 @@ func TestFullPatches(t *testing.T) {
 		runTest(t, &test, true)
 	}
 }
+
+func TestPatchErrors(t *testing.T) {
+	src := []byte(`{"foo":{"bar":[1,2]}}`)
+	var testErr *TestFailedError
+	var pathErr *PathNotFoundError
+	var rangeErr *IndexOutOfRangeError
+	var opErr *InvalidOpError
+
+	patch, _ := NewPatch([]byte(`[{"op":"add","path":"/baz","value":1},{"op":"test","path":"/foo/bar/0","value":2}]`))
+	_, err, loc := patch.Apply(src)
+	if !errors.As(err, &testErr) {
+		t.Fatalf("Expected a TestFailedError, got %#v", err)
+	}
+	if loc != 1 || testErr.OpIndex != 1 || testErr.Operation.Op != "test" {
+		t.Errorf("TestFailedError has wrong operation context: %v", testErr)
+	}
+	if testErr.Expected != json.Number("2") || testErr.Actual != json.Number("1") {
+		t.Errorf("TestFailedError has wrong values: %v", testErr)
+	}
+
+	patch, _ = NewPatch([]byte(`[{"op":"replace","path":"/foo/baz/0","value":2}]`))
+	_, err, _ = patch.Apply(src)
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("Expected a PathNotFoundError, got %#v", err)
+	}
+	if pathErr.Resolved.String() != "/foo" || pathErr.Segment != "baz" {
+		t.Errorf("PathNotFoundError has wrong pointer context: %v", pathErr)
+	}
+
+	patch, _ = NewPatch([]byte(`[{"op":"remove","path":"/foo/bar/5"}]`))
+	_, err, _ = patch.Apply(src)
+	if !errors.As(err, &rangeErr) {
+		t.Fatalf("Expected an IndexOutOfRangeError, got %#v", err)
+	}
+	if rangeErr.Resolved.String() != "/foo/bar" || rangeErr.Segment != "5" || rangeErr.Len != 2 {
+		t.Errorf("IndexOutOfRangeError has wrong pointer context: %v", rangeErr)
+	}
+
+	_, err = NewPatch([]byte(`[{"op":"remove","path":"/foo"},{"op":"frob","path":"/foo"}]`))
+	if !errors.As(err, &opErr) {
+		t.Fatalf("Expected an InvalidOpError, got %#v", err)
+	}
+	if opErr.OpIndex != 1 {
+		t.Errorf("InvalidOpError has wrong operation context: %v", opErr)
+	}
+
+	patch, _ = NewPatch([]byte(`[{"op":"move","from":"/foo","path":"/foo/bar/0"}]`))
+	_, err, _ = patch.Apply(src)
+	if !errors.As(err, &opErr) {
+		t.Fatalf("Expected an InvalidOpError, got %#v", err)
+	}
+	if opErr.OpIndex != 0 || opErr.Operation.Op != "move" {
+		t.Errorf("InvalidOpError has wrong operation context: %v", opErr)
+	}
+}
+
+func TestInPlacePatches(t *testing.T) {
+	for _, test := range opTests {
+		var src, final interface{}
+		utils.Unmarshal([]byte(test.src), &src)
+		utils.Unmarshal([]byte(test.final), &final)
+		orig := utils.Clone(src)
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			continue
+		}
+		res, err, idx := patch.ApplyDocument(src, ApplyOptions{InPlace: true})
+		if test.pass {
+			if err != nil {
+				t.Errorf("%v: failed to apply patch in place at %d: %v", test.desc, idx, err)
+			} else if !Equal(res, final) {
+				t.Errorf("%v: applying in place gave %v, expected %v", test.desc, res, final)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%v: expected patch applied in place to fail", test.desc)
+		} else if !Equal(res, orig) {
+			t.Errorf("%v: failed patch left %v instead of restoring %v", test.desc, res, orig)
+		}
+	}
+}
+
+func TestInPlaceRollback(t *testing.T) {
+	var doc interface{}
+	utils.Unmarshal([]byte(`{"a":1,"b":[1,2,3],"c":{"d":{"e":1}},"f":{"g":2}}`), &doc)
+	orig := utils.Clone(doc)
+	untouched := doc.(map[string]interface{})["f"].(map[string]interface{})
+	removed := doc.(map[string]interface{})["c"].(map[string]interface{})
+	patch, _ := NewPatch([]byte(`[
+{"op":"replace","path":"/a","value":2},
+{"op":"remove","path":"/b/0"},
+{"op":"add","path":"/b/-","value":4},
+{"op":"move","from":"/c/d","path":"/b/1"},
+{"op":"copy","from":"/a","path":"/c/x"},
+{"op":"remove","path":"/c"},
+{"op":"test","path":"/a","value":1}]`))
+	res, err, loc := patch.ApplyDocument(doc, ApplyOptions{InPlace: true})
+	if err == nil || loc != 6 {
+		t.Fatalf("Expected the patch to fail at op 6, got %v at %d", err, loc)
+	}
+	if !Equal(res, orig) {
+		t.Errorf("Failed patch left %v instead of restoring %v", res, orig)
+	}
+	if reflect.ValueOf(res.(map[string]interface{})["c"]).Pointer() != reflect.ValueOf(removed).Pointer() {
+		t.Errorf("Failed patch restored a copy of a removed value")
+	}
+	patch = patch[:6]
+	if res, err, _ = patch.ApplyDocument(res, ApplyOptions{InPlace: true}); err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+	var want interface{}
+	utils.Unmarshal([]byte(`{"a":2,"b":[2,{"e":1},3,4],"f":{"g":2}}`), &want)
+	if !Equal(res, want) {
+		t.Errorf("Patch applied in place gave %v, expected %v", res, want)
+	}
+	if reflect.ValueOf(res.(map[string]interface{})["f"]).Pointer() != reflect.ValueOf(untouched).Pointer() {
+		t.Errorf("Patch applied in place copied a value it did not touch")
+	}
+}
+
+func TestSharedPatches(t *testing.T) {
+	for _, test := range opTests {
+		var src, final interface{}
+		utils.Unmarshal([]byte(test.src), &src)
+		utils.Unmarshal([]byte(test.final), &final)
+		orig := utils.Clone(src)
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			continue
+		}
+		res, err, idx := patch.ApplyDocument(src, ApplyOptions{ShareUnchanged: true})
+		if !Equal(src, orig) {
+			t.Errorf("%v: applying with sharing changed the original to %v", test.desc, src)
+		}
+		if !test.pass {
+			if err == nil {
+				t.Errorf("%v: expected patch applied with sharing to fail", test.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: failed to apply patch with sharing at %d: %v", test.desc, idx, err)
+		} else if !Equal(res, final) {
+			t.Errorf("%v: applying with sharing gave %v, expected %v", test.desc, res, final)
+		}
+	}
+}
+
+func TestSharedApplyMatchesApply(t *testing.T) {
+	checkMatchesApply(t, "Applying with sharing", func(patch Patch, base interface{}) (interface{}, error, int) {
+		res, err, loc := patch.ApplyDocument(base, ApplyOptions{ShareUnchanged: true})
+		if err != nil {
+			return res, err, loc
+		}
+		// Patching the result again must not change the first result.
+		again := utils.Clone(res)
+		if _, err, _ = patch.ApplyDocument(res, ApplyOptions{ShareUnchanged: true}); err == nil && !Equal(res, again) {
+			t.Fatalf("Applying with sharing changed an earlier result")
+		}
+		return res, nil, 0
+	})
+}
+
+func TestSharedApplyShares(t *testing.T) {
+	var doc interface{}
+	utils.Unmarshal([]byte(`{"a":{"x":1,"y":[1,2]},"b":{"c":[1,2,3]}}`), &doc)
+	orig := utils.Clone(doc)
+	patch, _ := NewPatch([]byte(`[{"op":"replace","path":"/a/x","value":2},{"op":"add","path":"/a/y/-","value":3}]`))
+	res, err, _ := patch.ApplyDocument(doc, ApplyOptions{ShareUnchanged: true})
+	if err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+	if !Equal(doc, orig) {
+		t.Errorf("Applying with sharing changed the original to %v", doc)
+	}
+	before, after := doc.(map[string]interface{}), res.(map[string]interface{})
+	if reflect.ValueOf(before["b"]).Pointer() != reflect.ValueOf(after["b"]).Pointer() {
+		t.Errorf("Untouched value was copied")
+	}
+	if reflect.ValueOf(before["a"]).Pointer() == reflect.ValueOf(after["a"]).Pointer() {
+		t.Errorf("Changed value was not copied")
+	}
+}
+
+func TestApplyLeavesPatchAlone(t *testing.T) {
+	text := `[{"op":"add","path":"/a","value":{"b":1}},{"op":"add","path":"/a/c","value":2},{"op":"replace","path":"/d","value":[1]},{"op":"add","path":"/d/-","value":2}]`
+	patch, _ := NewPatch([]byte(text))
+	for i := 0; i < 2; i++ {
+		res, err, _ := patch.Apply([]byte(`{"d":null}`))
+		if err != nil || string(res) != `{"a":{"b":1,"c":2},"d":[1,2]}` {
+			t.Errorf("Applying the patch gave %s (%v)", res, err)
+		}
+	}
+	if orig, _ := NewPatch([]byte(text)); !reflect.DeepEqual(patch, orig) {
+		buf, _ := json.Marshal(patch)
+		t.Errorf("Applying the patch changed it to %s", buf)
+	}
+}
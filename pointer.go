@@ -107,51 +107,114 @@ func (p Pointer) Chop() (string, Pointer) {
 }
 
 func (p Pointer) Append(frag string) Pointer {
-	return append(p, pointerSegment(decode.Replace(frag)))
+	// Always make a fresh slice, otherwise siblings generated from
+	// the same parent would share (and overwrite) a backing array.
+	res := make(Pointer, len(p), len(p)+1)
+	copy(res, p)
+	return append(res, pointerSegment(decode.Replace(frag)))
 }
 
-func normalizeOffset(selector string, bound int) (int, error) {
-	res, err := strconv.Atoi(selector)
+// offset translates the array index in segment i of p into an
+// absolute offset into an array of length bound.
+func (p Pointer) offset(i, bound int) (int, error) {
+	res, err := strconv.Atoi(string(p[i]))
 	if err != nil {
-		return -1, err
+		return -1, &PathNotFoundError{newContext(p, i), fmt.Sprintf("%q is not an array index", p[i])}
 	}
 	if res < 0 {
 		res = bound + res
 	}
 	if res >= bound || res < 0 {
-		return -1, fmt.Errorf("Index out of bounds")
+		return -1, &IndexOutOfRangeError{newContext(p, i), bound}
 	}
 	return res, nil
 }
 
+// checkIndex checks that segment i of p is an array index opts allows.
+func (p Pointer) checkIndex(i int, opts ApplyOptions) error {
+	seg := string(p[i])
+	if seg == "-" && i == len(p)-1 {
+		return nil
+	}
+	digits := seg
+	if opts.NegativeIndexes && strings.HasPrefix(seg, "-") {
+		digits = seg[1:]
+	}
+	if digits == "" || (len(digits) > 1 && digits[0] == '0') || strings.Trim(digits, "0123456789") != "" {
+		return &PathNotFoundError{newContext(p, i), fmt.Sprintf("%q is not a valid array index", seg)}
+	}
+	return nil
+}
+
+// Validate checks that the array indexes p uses in doc are allowed
+// by opts.  Parts of p that do not resolve in doc are not checked,
+// as operations using p will fail on them anyways.
+func (p Pointer) Validate(doc interface{}, opts ApplyOptions) error {
+	if !opts.Strict {
+		return nil
+	}
+	for i := range p {
+		switch t := doc.(type) {
+		case map[string]interface{}:
+			found, ok := t[string(p[i])]
+			if !ok {
+				return nil
+			}
+			doc = found
+		case []interface{}:
+			if err := p.checkIndex(i, opts); err != nil {
+				return err
+			}
+			index, err := p.offset(i, len(t))
+			if err != nil {
+				return nil
+			}
+			doc = t[index]
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// missing returns the error for segment i of p not being a member of an object.
+func (p Pointer) missing(i int) error {
+	return &PathNotFoundError{newContext(p, i), "no such member"}
+}
+
+// notContainer returns the error for segment i of p trying to index
+// into a value that is not an object or an array.
+func (p Pointer) notContainer(i int) error {
+	return &PathNotFoundError{newContext(p, i), "cannot index non-indexable JSON value"}
+}
+
 // Get takes an unmarshalled JSON blob, and returns the value pointed at by the pointer.
 // The unmarshalled blob is left unchanged.
 func (p Pointer) Get(from interface{}) (interface{}, error) {
-	if len(p) == 0 {
-		return from, nil
-	}
-	selector, nextPointer := p.Shift()
-	switch t := from.(type) {
-	case map[string]interface{}:
-		found, ok := t[selector]
-		if !ok {
-			return nil, fmt.Errorf("Selector %v not a member of %#v", selector, t)
-		}
-		return nextPointer.Get(found)
-	case []interface{}:
-		index, err := normalizeOffset(selector, len(t))
-		if err != nil {
-			return nil, err
+	for i := range p {
+		switch t := from.(type) {
+		case map[string]interface{}:
+			found, ok := t[string(p[i])]
+			if !ok {
+				return nil, p.missing(i)
+			}
+			from = found
+		case []interface{}:
+			index, err := p.offset(i, len(t))
+			if err != nil {
+				return nil, err
+			}
+			from = t[index]
+		default:
+			return nil, p.notContainer(i)
 		}
-		return nextPointer.Get(t[index])
-	default:
-		return nil, fmt.Errorf("Cannot index pointer %v for non-indexable JSON value", p.String())
 	}
+	return from, nil
 }
 
 func (p Pointer) toContainer(to interface{}) (string, interface{}, error) {
 	if len(p) == 0 {
-		return "", nil, fmt.Errorf("Cannot happen")
+		return "", nil, &InvalidOpError{ErrorContext{Path: p}, "Cannot operate on the container of the whole document"}
 	}
 	selector, getPointer := p.Chop()
 	operatrix, err := getPointer.Get(to)
@@ -172,16 +235,16 @@ func (p Pointer) Replace(to interface{}, val interface{}) (interface{}, error) {
 		if _, ok := t[selector]; ok {
 			t[selector] = val
 		} else {
-			return to, fmt.Errorf("%v does not refer to an existing location", p.String())
+			return to, p.missing(len(p) - 1)
 		}
 	case []interface{}:
-		index, err := normalizeOffset(selector, len(t))
+		index, err := p.offset(len(p)-1, len(t))
 		if err != nil {
 			return to, err
 		}
 		t[index] = val
 	default:
-		return to, fmt.Errorf("Cannot put to non-indexable JSON value")
+		return to, p.notContainer(len(p) - 1)
 	}
 	return to, nil
 }
@@ -200,7 +263,9 @@ func (p Pointer) handleChangedSlice(to interface{}, s []interface{}) (interface{
 // to already exist or refer to a preexisting Value.
 //
 // Put may have to return a new to if to happens to be a slice, since
-// the semantics of Put necessarily involve growing the Slice.
+// the semantics of Put necessarily involve growing the Slice.  As
+// RFC 6902 allows, an index one past the end of a slice appends to it
+// just like "-" does.
 func (p Pointer) Put(to interface{}, val interface{}) (interface{}, error) {
 	selector, operatrix, err := p.toContainer(to)
 	if err != nil {
@@ -210,10 +275,10 @@ func (p Pointer) Put(to interface{}, val interface{}) (interface{}, error) {
 	case map[string]interface{}:
 		t[selector] = val
 	case []interface{}:
-		if selector == "-" {
+		if selector == "-" || selector == strconv.Itoa(len(t)) {
 			t = append(t, val)
 		} else {
-			index, err := normalizeOffset(selector, len(t))
+			index, err := p.offset(len(p)-1, len(t))
 			if err != nil {
 				return to, err
 			}
@@ -226,7 +291,7 @@ func (p Pointer) Put(to interface{}, val interface{}) (interface{}, error) {
 		}
 		return p.handleChangedSlice(to, t)
 	default:
-		return to, fmt.Errorf("Cannot put to non-indexable JSON value")
+		return to, p.notContainer(len(p) - 1)
 	}
 	return to, nil
 }
@@ -245,11 +310,11 @@ func (p *Pointer) Remove(from interface{}) (interface{}, error) {
 	switch t := operatrix.(type) {
 	case map[string]interface{}:
 		if _, ok := t[selector]; !ok {
-			return from, fmt.Errorf("`%v` does not point to an existing location", p.String())
+			return from, p.missing(len(*p) - 1)
 		}
 		delete(t, selector)
 	case []interface{}:
-		index, err := normalizeOffset(selector, len(t))
+		index, err := p.offset(len(*p)-1, len(t))
 		if err != nil {
 			return from, err
 		}
@@ -260,7 +325,7 @@ func (p *Pointer) Remove(from interface{}) (interface{}, error) {
 		t = t[:len(t)-1]
 		return p.handleChangedSlice(from, t)
 	default:
-		return from, fmt.Errorf("Cannot remove non-indexable JSON value")
+		return from, p.notContainer(len(*p) - 1)
 	}
 	return from, nil
 }
@@ -274,23 +339,37 @@ func (p Pointer) Copy(from interface{}, at Pointer) (interface{}, error) {
 	return at.Put(from, utils.Clone(val))
 }
 
+// checkMove makes sure that at is not inside p, since RFC 6902 does
+// not allow moving a value into one of its own children.
+func (p Pointer) checkMove(at Pointer) error {
+	if len(at) > len(p) && p.Contains(at) {
+		return &InvalidOpError{newContext(at, len(p)), fmt.Sprintf("Cannot move %v into its own child %v", p, at)}
+	}
+	return nil
+}
+
 // Move moves the value pointed to by p in from to the location pointed to by at.
+// As RFC 6902 specifies, the value is removed from p before at is
+// resolved, so at sees any array indexes shifted by the removal.
 func (p Pointer) Move(from interface{}, at Pointer) (interface{}, error) {
+	if err := p.checkMove(at); err != nil {
+		return from, err
+	}
 	val, err := p.Get(from)
 	if err != nil {
 		return from, err
 	}
-	val, err = at.Put(from, val)
+	from, err = p.Remove(from)
 	if err != nil {
-		return val, err
+		return from, err
 	}
-	return p.Remove(val)
+	return at.Put(from, val)
 }
 
 func (p *Pointer) Test(from interface{}, sample interface{}) error {
 	val, err := p.Get(from)
-	if err == nil && !reflect.DeepEqual(val, sample) {
-		err = fmt.Errorf("Test op failed.")
+	if err == nil && !Equal(val, sample) {
+		err = &TestFailedError{newContext(*p, len(*p)), sample, val}
 	}
 	return err
 }
@@ -1,6 +1,9 @@
 package jsonpatch2
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 type ptrTest struct {
 	sample string
@@ -63,3 +66,45 @@ func TestPointers(t *testing.T) {
 		}
 	}
 }
+
+type validateTest struct {
+	ptr      string
+	strict   bool
+	negative bool
+	valid    bool
+}
+
+var validateTests = []validateTest{
+	{`/foo/0`, true, false, true},
+	{`/foo/10`, true, false, true},
+	{`/foo/-`, true, false, true},
+	{`/foo/01`, false, false, true},
+	{`/foo/01`, true, false, false},
+	{`/foo/-1`, false, false, true},
+	{`/foo/-1`, true, false, false},
+	{`/foo/-1`, true, true, true},
+	{`/foo/-01`, true, true, false},
+	{`/foo/+1`, true, false, false},
+	{`/foo/-/0`, true, false, false},
+	{`/foo/1/01`, true, false, true},
+	{`/foo/1/bar/01`, true, false, false},
+	{`/bar/01`, true, false, true},
+	{`/missing/01`, true, false, true},
+}
+
+func TestValidate(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"foo":[1,{"01":1,"bar":[1,2]}],"bar":{"01":1}}`), &doc)
+	for _, test := range validateTests {
+		ptr, err := NewPointer(test.ptr)
+		if err != nil {
+			t.Fatalf("Failed to make pointer %v: %v", test.ptr, err)
+		}
+		err = ptr.Validate(doc, ApplyOptions{Strict: test.strict, NegativeIndexes: test.negative})
+		if test.valid && err != nil {
+			t.Errorf("%v should be valid with strict %v, negative %v: %v", test.ptr, test.strict, test.negative, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%v should not be valid with strict %v, negative %v", test.ptr, test.strict, test.negative)
+		}
+	}
+}
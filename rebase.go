@@ -0,0 +1,242 @@
+package jsonpatch2
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// rebaseOutcome is what happened to a pointer when it was rebased.
+type rebaseOutcome int
+
+const (
+	rebaseKeep rebaseOutcome = iota
+	rebaseDrop
+	rebaseConflict
+)
+
+var indexRE = regexp.MustCompile(`^(0|[1-9][0-9]*)$`)
+
+// segIndex returns the array index s refers to.  Rebasing works
+// without a document, so any segment that looks like an index is
+// assumed to be one.
+func segIndex(s pointerSegment) (int, bool) {
+	if !indexRE.MatchString(string(s)) {
+		return 0, false
+	}
+	i, err := strconv.Atoi(string(s))
+	return i, err == nil
+}
+
+// siblings tests whether q has the same parent as the last segment of p,
+// or is below such a sibling.
+func siblings(p, q Pointer) bool {
+	return len(p) > 0 && len(q) >= len(p) && p[:len(p)-1].Contains(q)
+}
+
+// withIndex returns a copy of q with the segment at pos set to i.
+func withIndex(q Pointer, pos, i int) Pointer {
+	res := append(Pointer{}, q...)
+	res[pos] = pointerSegment(strconv.Itoa(i))
+	return res
+}
+
+// rebaseRemove adjusts q for the removal of the value at r.  insert
+// is true if q is where a value is being inserted rather than a value
+// that has to exist.
+func rebaseRemove(q, r Pointer, insert bool) (Pointer, rebaseOutcome) {
+	if !siblings(r, q) {
+		return q, rebaseKeep
+	}
+	n := len(r) - 1
+	ri, rIdx := segIndex(r[n])
+	qi, qIdx := segIndex(q[n])
+	switch {
+	case rIdx && qIdx && qi > ri:
+		return withIndex(q, n, qi-1), rebaseKeep
+	case q[n] != r[n]:
+		return q, rebaseKeep
+	case insert && len(q) == len(r):
+		return q, rebaseKeep
+	default:
+		return q, rebaseDrop
+	}
+}
+
+// rebaseAdd adjusts q for a value being added at a.  When both q and a
+// insert at the same array index, q goes after a unless first is set.
+func rebaseAdd(q, a Pointer, insert, first bool) (Pointer, rebaseOutcome) {
+	if len(a) == 0 {
+		return q, rebaseConflict
+	}
+	if !siblings(a, q) || a[len(a)-1] == "-" {
+		return q, rebaseKeep
+	}
+	n := len(a) - 1
+	ai, aIdx := segIndex(a[n])
+	qi, qIdx := segIndex(q[n])
+	switch {
+	case aIdx && qIdx:
+		if qi > ai || (qi == ai && (len(q) > len(a) || !insert || !first)) {
+			return withIndex(q, n, qi+1), rebaseKeep
+		}
+		return q, rebaseKeep
+	case q[n] == a[n]:
+		// An object member was set, which overwrites whatever q
+		// wanted to do there.
+		return q, rebaseConflict
+	}
+	return q, rebaseKeep
+}
+
+// rebasePointer adjusts q so that it points at the same place after
+// b has been applied.
+func rebasePointer(q Pointer, b Operation, insert, first bool) (Pointer, rebaseOutcome) {
+	switch b.Op {
+	case "remove":
+		return rebaseRemove(q, b.path, insert)
+	case "add", "copy":
+		return rebaseAdd(q, b.path, insert, first)
+	case "replace":
+		if b.path.Contains(q) {
+			return q, rebaseConflict
+		}
+	case "move":
+		if b.from.Contains(q) && !(insert && len(q) == len(b.from)) {
+			return append(append(Pointer{}, b.path...), q[len(b.from):]...), rebaseKeep
+		}
+		q, res := rebaseRemove(q, b.from, insert)
+		if res != rebaseKeep {
+			return q, res
+		}
+		return rebaseAdd(q, b.path, insert, first)
+	}
+	return q, rebaseKeep
+}
+
+// duplicates tests whether a and b make the same change, in which
+// case a does not need to be made again after b.  Inserts into arrays
+// are never duplicates, since inserting twice is a different change.
+func duplicates(a, b Operation) bool {
+	if a.Op != b.Op || a.Path != b.Path || a.From != b.From || !Equal(a.Value, b.Value) {
+		return false
+	}
+	switch a.Op {
+	case "add", "copy", "move":
+		if len(a.path) == 0 {
+			return true
+		}
+		last := a.path[len(a.path)-1]
+		_, idx := segIndex(last)
+		return !idx && last != "-"
+	}
+	return true
+}
+
+// conflictRoot returns the part of the document that both a and b
+// change, where a and b apply to the same document.  As with
+// ThreeWayMerge, a change to any element of an array is treated as a
+// change to the whole array, so the result does not depend on array
+// indexes that earlier ops shifted.
+func conflictRoot(a, b Operation) Pointer {
+	res := a.path
+	for _, o := range []Operation{a, b} {
+		changed := []Pointer{o.path}
+		if o.Op == "move" {
+			changed = append(changed, o.from)
+		}
+		for _, q := range changed {
+			i := 0
+			for i < len(res) && i < len(q) && res[i] == q[i] {
+				i++
+			}
+			res = res[:i]
+		}
+	}
+	for i, seg := range res {
+		if _, idx := segIndex(seg); idx || seg == "-" {
+			return res[:i]
+		}
+	}
+	return res
+}
+
+// rebaseOp adjusts a so it can be applied after b.  first is set
+// when a is considered to have happened before b.
+func rebaseOp(a, b Operation, first bool) (Operation, rebaseOutcome) {
+	if !first && duplicates(a, b) {
+		return a, rebaseDrop
+	}
+	insert := a.Op == "add" || a.Op == "copy" || a.Op == "move"
+	path, res := rebasePointer(a.path, b, insert, first)
+	if res != rebaseKeep {
+		return a, res
+	}
+	if a.Op == "move" || a.Op == "copy" {
+		from, res := rebasePointer(a.from, b, false, first)
+		if res != rebaseKeep {
+			return a, res
+		}
+		a.from, a.From = from, from.String()
+	}
+	a.path, a.Path = path, path.String()
+	return a, rebaseKeep
+}
+
+// Rebase transforms p, which was made against the same document as
+// other, so that it can be applied after other and still make the
+// same changes.  Array indexes are shifted to account for values
+// other added and removed, paths under values other moved are
+// rewritten to follow them, and ops on values other removed are
+// dropped.  Ops that change something other replaced or set are true
+// conflicts, and are left out of result and returned as conflicts.
+// When both patches insert at the same array index, the value from
+// other comes first.
+//
+// Rebase does not look at the document the patches apply to, so any
+// path segment that looks like an array index is assumed to be one.
+// Object members with numeric names are shifted as if they were array
+// elements: rebasing /a/1 over an add at /a/0 gives /a/2 even when /a
+// is an object.  Use ThreeWayMerge when that matters.
+//
+// Each Conflict holds the op from p and the op from other as they were
+// passed in.
+func (p Patch) Rebase(other Patch) (result Patch, conflicts []Conflict, err error) {
+	if err = p.fixPointers(); err != nil {
+		return nil, nil, err
+	}
+	if err = other.fixPointers(); err != nil {
+		return nil, nil, err
+	}
+	result, conflicts = make(Patch, 0, len(p)), []Conflict{}
+	// rest holds the ops of other as they would be applied after the
+	// rebased ops in result, and src holds the index in other each
+	// came from.
+	rest, src := append(Patch{}, other...), make([]int, len(other))
+	for i := range src {
+		src[i] = i
+	}
+	for _, op := range p {
+		cur, res := op, rebaseKeep
+		next, nextSrc := make(Patch, 0, len(rest)), make([]int, 0, len(rest))
+		for j, b := range rest {
+			var a Operation
+			if a, res = rebaseOp(cur, b, false); res != rebaseKeep {
+				if res == rebaseConflict {
+					conflicts = append(conflicts, Conflict{conflictRoot(cur, b), Patch{op}, Patch{other[src[j]]}})
+				}
+				break
+			}
+			// b loses to cur, so ops of other that cur overwrote or
+			// removed are no longer relevant.
+			if nb, bres := rebaseOp(b, cur, true); bres == rebaseKeep {
+				next, nextSrc = append(next, nb), append(nextSrc, src[j])
+			}
+			cur = a
+		}
+		if res == rebaseKeep {
+			result = append(result, cur)
+			rest, src = next, nextSrc
+		}
+	}
+	return result, conflicts, nil
+}
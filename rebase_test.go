@@ -0,0 +1,124 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+var rebaseTests = []struct {
+	base, other, patch, final string
+	conflicts                 int
+}{
+	// Independent object changes
+	{`{"a":1,"b":2}`, `[{"op":"replace","path":"/a","value":3}]`, `[{"op":"replace","path":"/b","value":4}]`, `{"a":3,"b":4}`, 0},
+	// Array index shifting
+	{`{"a":[1,2,3]}`, `[{"op":"add","path":"/a/0","value":0}]`, `[{"op":"replace","path":"/a/2","value":4}]`, `{"a":[0,1,2,4]}`, 0},
+	{`{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/0"}]`, `[{"op":"replace","path":"/a/2","value":4}]`, `{"a":[2,4]}`, 0},
+	{`{"a":[1,2,3]}`, `[{"op":"add","path":"/a/1","value":"x"}]`, `[{"op":"add","path":"/a/1","value":"y"}]`, `{"a":[1,"x","y",2,3]}`, 0},
+	{`{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `[{"op":"add","path":"/a/1","value":"y"}]`, `{"a":[1,"y",3]}`, 0},
+	{`{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `[{"op":"add","path":"/a/0","value":"y"},{"op":"add","path":"/a/2","value":"w"}]`, `{"a":["y",1,"w",3]}`, 0},
+	{`{"a":[{"b":1},{"b":2}]}`, `[{"op":"add","path":"/a/0","value":{"b":0}}]`, `[{"op":"replace","path":"/a/1/b","value":5}]`, `{"a":[{"b":0},{"b":1},{"b":5}]}`, 0},
+	{`{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, `[{"op":"add","path":"/a/0","value":0}]`, `{"a":[0,1,2,3]}`, 0},
+	// Ops on removed values are dropped
+	{`{"a":{"b":1},"c":1}`, `[{"op":"remove","path":"/a"}]`, `[{"op":"replace","path":"/a/b","value":2},{"op":"replace","path":"/c","value":2}]`, `{"c":2}`, 0},
+	{`{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `[{"op":"replace","path":"/a/1","value":5}]`, `{"a":[1,3]}`, 0},
+	{`{"a":1}`, `[{"op":"remove","path":"/a"}]`, `[{"op":"remove","path":"/a"}]`, `{}`, 0},
+	// Moves
+	{`{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a","path":"/c/d"}]`, `[{"op":"replace","path":"/a/b","value":2}]`, `{"c":{"d":{"b":2}}}`, 0},
+	{`{"a":[1,2,3,4]}`, `[{"op":"move","from":"/a/0","path":"/a/3"}]`, `[{"op":"replace","path":"/a/2","value":5}]`, `{"a":[2,5,4,1]}`, 0},
+	// Our ops are applied after ops of other they overwrite
+	{`{"a":{"b":1}}`, `[{"op":"replace","path":"/a/b","value":2}]`, `[{"op":"replace","path":"/a","value":3}]`, `{"a":3}`, 0},
+	{`{"a":1}`, `[{"op":"replace","path":"/a","value":2}]`, `[{"op":"replace","path":"/a","value":2}]`, `{"a":2}`, 0},
+	// True conflicts
+	{`{"a":1}`, `[{"op":"replace","path":"/a","value":2}]`, `[{"op":"replace","path":"/a","value":3}]`, `{"a":2}`, 1},
+	{`{"a":{"b":1}}`, `[{"op":"replace","path":"/a","value":{"c":1}}]`, `[{"op":"replace","path":"/a/b","value":2}]`, `{"a":{"c":1}}`, 1},
+	{`{}`, `[{"op":"add","path":"/a","value":1}]`, `[{"op":"add","path":"/a","value":2},{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, 1},
+}
+
+func TestRebase(t *testing.T) {
+	for _, test := range rebaseTests {
+		other, err := NewPatch([]byte(test.other))
+		if err != nil {
+			t.Fatalf("Bad patch %v: %v", test.other, err)
+		}
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			t.Fatalf("Bad patch %v: %v", test.patch, err)
+		}
+		rebased, conflicts, err := patch.Rebase(other)
+		if err != nil {
+			t.Errorf("Rebasing %v onto %v failed: %v", test.patch, test.other, err)
+			continue
+		}
+		buf, _ := json.Marshal(rebased)
+		if len(conflicts) != test.conflicts {
+			t.Errorf("Rebasing %v onto %v gave %d conflicts, expected %d", test.patch, test.other, len(conflicts), test.conflicts)
+		}
+		mid, err, _ := other.Apply([]byte(test.base))
+		if err != nil {
+			t.Fatalf("Patch %v failed to apply to `%v`: %v", test.other, test.base, err)
+		}
+		res, err, loc := rebased.Apply(mid)
+		if err != nil {
+			t.Errorf("Rebased patch %v failed at %d: %v", string(buf), loc, err)
+			continue
+		}
+		var got, want interface{}
+		utils.Unmarshal(res, &got)
+		utils.Unmarshal([]byte(test.final), &want)
+		if !Equal(got, want) {
+			t.Errorf("Rebased patch %v turned `%v` into `%v`, expected `%v`", string(buf), string(mid), string(res), test.final)
+		}
+	}
+}
+
+func TestRebaseConflicts(t *testing.T) {
+	tests := []struct {
+		other, patch, path, ours, theirs string
+	}{
+		{
+			`[{"op":"replace","path":"/a","value":{"c":1}}]`,
+			`[{"op":"replace","path":"/a/b","value":2}]`,
+			"/a",
+			`[{"op":"replace","path":"/a/b","value":2}]`,
+			`[{"op":"replace","path":"/a","value":{"c":1}}]`,
+		},
+		{
+			`[{"op":"replace","path":"/a/1","value":5}]`,
+			`[{"op":"add","path":"/a/0","value":0},{"op":"replace","path":"/a/2/b","value":6}]`,
+			"/a",
+			`[{"op":"replace","path":"/a/2/b","value":6}]`,
+			`[{"op":"replace","path":"/a/1","value":5}]`,
+		},
+		{
+			`[{"op":"add","path":"","value":1}]`,
+			`[{"op":"add","path":"/x/y","value":2}]`,
+			"",
+			`[{"op":"add","path":"/x/y","value":2}]`,
+			`[{"op":"add","path":"","value":1}]`,
+		},
+	}
+	for _, test := range tests {
+		other, _ := NewPatch([]byte(test.other))
+		patch, _ := NewPatch([]byte(test.patch))
+		_, conflicts, err := patch.Rebase(other)
+		if err != nil {
+			t.Errorf("Rebasing %v onto %v failed: %v", test.patch, test.other, err)
+			continue
+		}
+		if len(conflicts) != 1 {
+			t.Errorf("Rebasing %v onto %v gave %d conflicts, expected 1", test.patch, test.other, len(conflicts))
+			continue
+		}
+		c := conflicts[0]
+		ours, _ := NewPatch([]byte(test.ours))
+		theirs, _ := NewPatch([]byte(test.theirs))
+		if c.Path.String() != test.path || !reflect.DeepEqual(c.Ours, ours) || !reflect.DeepEqual(c.Theirs, theirs) {
+			t.Errorf("Rebasing %v onto %v gave conflict at %q with %v and %v, expected %q with %v and %v",
+				test.patch, test.other, c.Path.String(), c.Ours, c.Theirs, test.path, test.ours, test.theirs)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package jsonpatch2
+
+import "reflect"
+
+// owner tracks the containers that a patch applied with
+// ApplyOptions.ShareUnchanged has copied, and so may change freely.
+type owner map[uintptr]bool
+
+// own returns a shallow copy of v if it is a container that has not
+// been copied yet.
+func (w owner) own(v interface{}) interface{} {
+	var res interface{}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if w[reflect.ValueOf(t).Pointer()] {
+			return t
+		}
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = val
+		}
+		res = m
+	case []interface{}:
+		// Nothing can be changed in place in a slice with no
+		// capacity, and they all share the same address.
+		if cap(t) == 0 || w[reflect.ValueOf(t).Pointer()] {
+			return t
+		}
+		res = append(make([]interface{}, 0, len(t)), t...)
+	default:
+		return v
+	}
+	w[reflect.ValueOf(res).Pointer()] = true
+	return res
+}
+
+// ownPath makes sure that every container in doc that an op at p
+// could change has been copied, returning the possibly new doc.
+func (w owner) ownPath(doc interface{}, p Pointer) (interface{}, error) {
+	if len(p) == 0 {
+		return doc, nil
+	}
+	doc = w.own(doc)
+	cur := doc
+	for i, seg := range p[:len(p)-1] {
+		switch t := cur.(type) {
+		case map[string]interface{}:
+			child, ok := t[string(seg)]
+			if !ok {
+				return doc, p.missing(i)
+			}
+			cur = w.own(child)
+			t[string(seg)] = cur
+		case []interface{}:
+			index, err := p.offset(i, len(t))
+			if err != nil {
+				return doc, err
+			}
+			cur = w.own(t[index])
+			t[index] = cur
+		default:
+			return doc, p.notContainer(i)
+		}
+	}
+	return doc, nil
+}
+
+// applyShared applies o to doc, copying only the containers it changes.
+func (o *Operation) applyShared(doc interface{}, w owner) (interface{}, error) {
+	switch o.Op {
+	case "test":
+		return o.apply(doc)
+	case "move":
+		// The remove can shift array indexes in o.path, so o.path has
+		// to be resolved after it.
+		if err := o.from.checkMove(o.path); err != nil {
+			return doc, err
+		}
+		val, err := o.from.Get(doc)
+		if err != nil {
+			return doc, err
+		}
+		if doc, err = w.ownPath(doc, o.from); err != nil {
+			return doc, err
+		}
+		if doc, err = o.from.Remove(doc); err != nil {
+			return doc, err
+		}
+		if doc, err = w.ownPath(doc, o.path); err != nil {
+			return doc, err
+		}
+		return o.path.Put(doc, val)
+	default:
+		doc, err := w.ownPath(doc, o.path)
+		if err != nil {
+			return doc, err
+		}
+		return o.apply(doc)
+	}
+}
+
+// applyShared applies p to base, sharing everything p does not change
+// between base and result.
+func (p Patch) applyShared(base interface{}, opts ApplyOptions) (result interface{}, err error, loc int) {
+	w := owner{}
+	result = base
+	for i := range p {
+		if err = p[i].validate(result, opts); err == nil {
+			result, err = p[i].applyShared(result, w)
+		}
+		if err != nil {
+			return result, withOp(err, p[i], i), i
+		}
+	}
+	return result, nil, 0
+}
@@ -0,0 +1,131 @@
+package jsonpatch2
+
+type edit byte
+
+const (
+	editKeep edit = iota
+	editDel
+	editAdd
+)
+
+// maxSliceDiffCost bounds the amount of work diffSlices will do
+// looking for a minimal edit script.  Past this, the arrays are
+// different enough that pairing elements up by position is just as
+// good.
+const maxSliceDiffCost = 2000
+
+// diffSlices computes an edit script that turns a into b, using
+// the Myers O(ND) diff algorithm.  The returned edits consume
+// elements from a (editKeep and editDel) and b (editKeep and editAdd)
+// in order.
+func diffSlices(a, b []interface{}) []edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && Equal(a[prefix], b[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		Equal(a[len(a)-1-suffix], b[len(b)-1-suffix]) {
+		suffix++
+	}
+	res := make([]edit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		res = append(res, editKeep)
+	}
+	res = append(res, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for i := 0; i < suffix; i++ {
+		res = append(res, editKeep)
+	}
+	return res
+}
+
+func myers(a, b []interface{}) []edit {
+	n, m := len(a), len(b)
+	limit := n
+	if m > limit {
+		limit = m
+	}
+	if limit > maxSliceDiffCost {
+		limit = maxSliceDiffCost
+	}
+	// v[k+off] holds the furthest x reached on diagonal k.
+	off := n + m + 1
+	v := make([]int, 2*off+1)
+	trace := make([][]int, 0)
+	for d := 0; d <= n+m; d++ {
+		if d > limit {
+			return positionalEdits(n, m)
+		}
+		// Only diagonals -d..d are live at this point.
+		snap := make([]int, 2*d+3)
+		copy(snap, v[off-d-1:off+d+2])
+		trace = append(trace, snap)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && Equal(a[x], b[y]) {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return positionalEdits(n, m)
+}
+
+func backtrack(trace [][]int, n, m int) []edit {
+	res := make([]edit, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		// trace[d] covers diagonals -d-1..d+1
+		at := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			res = append(res, editKeep)
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			res = append(res, editAdd)
+		} else {
+			res = append(res, editDel)
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		res = append(res, editKeep)
+		x, y = x-1, y-1
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// positionalEdits deletes everything in a and adds everything in b,
+// which sliceGen will pair up element by element.
+func positionalEdits(n, m int) []edit {
+	res := make([]edit, 0, n+m)
+	for i := 0; i < n; i++ {
+		res = append(res, editDel)
+	}
+	for i := 0; i < m; i++ {
+		res = append(res, editAdd)
+	}
+	return res
+}
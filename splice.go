@@ -0,0 +1,259 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+// rawItem is where a member of an object or an element of an array
+// is in a document.  lead is just past the comma or bracket before
+// it, key and keyEnd are the span of a member's key (both are start
+// for an element), and start and end are the span of its value.
+type rawItem struct {
+	name                          string
+	lead, key, keyEnd, start, end int
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// skipSpace returns the index of the first byte at or after i in buf
+// that is not whitespace.
+func skipSpace(buf []byte, i int) int {
+	for i < len(buf) && isSpace(buf[i]) {
+		i++
+	}
+	return i
+}
+
+// valueEnd returns the end of the value that starts at buf[i].  buf
+// must already be known to be valid JSON.
+func valueEnd(buf []byte, i int) int {
+	depth := 0
+	for ; i < len(buf); i++ {
+		switch c := buf[i]; c {
+		case '"':
+			for i++; buf[i] != '"'; i++ {
+				if buf[i] == '\\' {
+					i++
+				}
+			}
+			if depth == 0 {
+				return i + 1
+			}
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case ',', ':':
+			if depth == 0 {
+				return i
+			}
+		default:
+			if depth == 0 && isSpace(c) {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// rawItems returns the members or elements of the object or array
+// that starts at buf[i].
+func rawItems(buf []byte, i int) []rawItem {
+	res := []rawItem{}
+	obj := buf[i] == '{'
+	i++
+	for {
+		lead := i
+		i = skipSpace(buf, i)
+		if buf[i] == '}' || buf[i] == ']' {
+			return res
+		}
+		item := rawItem{lead: lead, key: i, keyEnd: i}
+		if obj {
+			item.keyEnd = valueEnd(buf, i)
+			json.Unmarshal(buf[i:item.keyEnd], &item.name)
+			// Skip the colon after the key.
+			i = skipSpace(buf, skipSpace(buf, item.keyEnd)+1)
+		}
+		item.start, item.end = i, valueEnd(buf, i)
+		res = append(res, item)
+		if i = skipSpace(buf, item.end); buf[i] == ',' {
+			i++
+		}
+	}
+}
+
+// rawIndex returns which of items segment i of p refers to, or -1.
+// As with decoding, the last of any duplicate keys is the one used.
+func rawIndex(obj bool, items []rawItem, p Pointer, i int) int {
+	if !obj {
+		index, err := p.offset(i, len(items))
+		if err != nil {
+			return -1
+		}
+		return index
+	}
+	for j := len(items) - 1; j >= 0; j-- {
+		if items[j].name == string(p[i]) {
+			return j
+		}
+	}
+	return -1
+}
+
+// rawFind returns the span of the value p points at in buf.  p must
+// exist in the document.
+func rawFind(buf []byte, p Pointer) (start, end int) {
+	start = skipSpace(buf, 0)
+	end = valueEnd(buf, start)
+	for i := range p {
+		items := rawItems(buf, start)
+		item := items[rawIndex(buf[start] == '{', items, p, i)]
+		start, end = item.start, item.end
+	}
+	return start, end
+}
+
+// splice returns a copy of buf with the bytes from start to end
+// replaced by vals.
+func splice(buf []byte, start, end int, vals ...[]byte) []byte {
+	res := make([]byte, 0, len(buf))
+	res = append(res, buf[:start]...)
+	for _, v := range vals {
+		res = append(res, v...)
+	}
+	return append(res, buf[end:]...)
+}
+
+// rawGap returns the whitespace to put before a new item added next
+// to item j, copied from the items already there.
+func rawGap(buf []byte, items []rawItem, j int) []byte {
+	if j == 0 && len(items) > 1 {
+		j = 1
+	}
+	return buf[items[j].lead:items[j].key]
+}
+
+var comma = []byte(",")
+
+// rawPut is Pointer.Put for the document in buf, with val already
+// encoded.
+func rawPut(buf []byte, p Pointer, val []byte) []byte {
+	if len(p) == 0 {
+		start, end := rawFind(buf, p)
+		return splice(buf, start, end, val)
+	}
+	selector, parent := p.Chop()
+	start, _ := rawFind(buf, parent)
+	items := rawItems(buf, start)
+	last := len(items) - 1
+	if buf[start] == '{' {
+		if j := rawIndex(true, items, p, len(p)-1); j != -1 {
+			return splice(buf, items[j].start, items[j].end, val)
+		}
+		key, _ := json.Marshal(selector)
+		if last == -1 {
+			return splice(buf, start+1, start+1, key, []byte(":"), val)
+		}
+		item := items[last]
+		return splice(buf, item.end, item.end, comma, rawGap(buf, items, last), key, buf[item.keyEnd:item.start], val)
+	}
+	if selector != "-" && selector != strconv.Itoa(len(items)) {
+		j := rawIndex(false, items, p, len(p)-1)
+		return splice(buf, items[j].start, items[j].start, val, comma, rawGap(buf, items, j))
+	}
+	if last == -1 {
+		return splice(buf, start+1, start+1, val)
+	}
+	return splice(buf, items[last].end, items[last].end, comma, rawGap(buf, items, last), val)
+}
+
+// rawRemove is Pointer.Remove for the document in buf.  The removed
+// item takes one of the commas next to it along with it.
+func rawRemove(buf []byte, p Pointer) []byte {
+	_, parent := p.Chop()
+	start, _ := rawFind(buf, parent)
+	obj := buf[start] == '{'
+	for {
+		items := rawItems(buf, start)
+		j := rawIndex(obj, items, p, len(p)-1)
+		if j == -1 {
+			return buf
+		}
+		switch {
+		case j < len(items)-1:
+			buf = splice(buf, items[j].key, items[j+1].key)
+		case j > 0:
+			buf = splice(buf, items[j-1].end, items[j].end)
+		default:
+			buf = splice(buf, items[j].key, items[j].end)
+		}
+		// Removing a key has to remove any duplicates of it too.
+		if !obj {
+			return buf
+		}
+	}
+}
+
+// splice makes the change o makes to the document in buf, which o
+// must already be known to apply to.
+func (o *Operation) splice(buf []byte) ([]byte, error) {
+	switch o.Op {
+	case "replace", "add":
+		val, err := json.Marshal(o.Value)
+		if err != nil {
+			return buf, err
+		}
+		if o.Op == "add" {
+			return rawPut(buf, o.path, val), nil
+		}
+		start, end := rawFind(buf, o.path)
+		return splice(buf, start, end, val), nil
+	case "remove":
+		return rawRemove(buf, o.path), nil
+	case "move", "copy":
+		if o.Op == "move" && o.from.String() == o.path.String() {
+			return buf, nil
+		}
+		// The value keeps its original bytes wherever it ends up.
+		start, end := rawFind(buf, o.from)
+		val := append([]byte{}, buf[start:end]...)
+		if o.Op == "move" {
+			buf = rawRemove(buf, o.from)
+		}
+		return rawPut(buf, o.path, val), nil
+	}
+	return buf, nil
+}
+
+// applySpliced applies p to base by editing only the bytes of the
+// values that ops change.
+func (p Patch) applySpliced(base []byte, opts ApplyOptions) (result []byte, err error, loc int) {
+	var doc interface{}
+	if err = utils.Unmarshal(base, &doc); err != nil {
+		return nil, err, 0
+	}
+	// Applying p to the decoded document first catches every error,
+	// so the splicing below never has to deal with any.
+	if _, err, loc = p.apply(doc, opts); err != nil {
+		return nil, err, loc
+	}
+	result = append([]byte{}, base...)
+	for i := range p {
+		if result, err = p[i].splice(result); err != nil {
+			return nil, withOp(err, p[i], i), i
+		}
+	}
+	return result, nil, 0
+}
@@ -0,0 +1,75 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+var splicedTests = []struct {
+	src, patch, final string
+}{
+	{`{"b": 1.0, "a": "é"}`, `[{"op":"replace","path":"/b","value":2}]`, `{"b": 2, "a": "é"}`},
+	{`{"b": 1.0, "a": "é"}`, `[{"op":"test","path":"/b","value":1.0}]`, `{"b": 1.0, "a": "é"}`},
+	{`{"b": 1.0, "a": "é"}`, `[{"op":"add","path":"/c","value":[1]}]`, `{"b": 1.0, "a": "é", "c": [1]}`},
+	{`{"b": 1.0, "a": "é"}`, `[{"op":"add","path":"/b","value":null}]`, `{"b": null, "a": "é"}`},
+	{`{"b": 1.0, "a": "é"}`, `[{"op":"remove","path":"/b"}]`, `{"a": "é"}`},
+	{`{"b": 1.0, "a": "é"}`, `[{"op":"remove","path":"/a"}]`, `{"b": 1.0}`},
+	{`{ "b" : 1.0 }`, `[{"op":"remove","path":"/b"}]`, `{  }`},
+	{`{ }`, `[{"op":"add","path":"/b","value":1}]`, `{"b":1 }`},
+	{"{\n  \"b\": 1.0\n}\n", `[{"op":"add","path":"/a","value":true}]`, "{\n  \"b\": 1.0,\n  \"a\": true\n}\n"},
+	{`[1.0, 2.0, 3.0]`, `[{"op":"add","path":"/1","value":5}]`, `[1.0, 5, 2.0, 3.0]`},
+	{`[1.0, 2.0, 3.0]`, `[{"op":"add","path":"/0","value":5}]`, `[5, 1.0, 2.0, 3.0]`},
+	{`[1.0, 2.0, 3.0]`, `[{"op":"add","path":"/-","value":5}]`, `[1.0, 2.0, 3.0, 5]`},
+	{`[1.0, 2.0, 3.0]`, `[{"op":"add","path":"/3","value":5}]`, `[1.0, 2.0, 3.0, 5]`},
+	{`[1.0, 2.0, 3.0]`, `[{"op":"remove","path":"/-1"}]`, `[1.0, 2.0]`},
+	{`[1.0, 2.0, 3.0]`, `[{"op":"remove","path":"/0"}]`, `[2.0, 3.0]`},
+	{`[]`, `[{"op":"add","path":"/-","value":{"a":1}}]`, `[{"a":1}]`},
+	{`[1.0, {"a" : [ 2.0 ]}]`, `[{"op":"move","from":"/1/a","path":"/0"}]`, `[[ 2.0 ], 1.0, {}]`},
+	{`[1.0, {"a" : [ 2.0 ]}]`, `[{"op":"copy","from":"/1","path":"/1/b"}]`, `[1.0, {"a" : [ 2.0 ],"b" : {"a" : [ 2.0 ]}}]`},
+	{`{"a": 1.0, "b": 2.0}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a": 1.0, "b": 2.0}`},
+	{`{"a": 1.0, "b": 2.0, "a": 3.0}`, `[{"op":"remove","path":"/a"}]`, `{"b": 2.0}`},
+	{` "a" `, `[{"op":"replace","path":"","value":{"b":"c"}}]`, ` {"b":"c"} `},
+}
+
+func TestSplicedPatches(t *testing.T) {
+	for _, test := range splicedTests {
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			t.Fatalf("Bad patch %v: %v", test.patch, err)
+		}
+		res, err, _ := patch.ApplyWithOptions([]byte(test.src), ApplyOptions{PreserveBytes: true})
+		if err != nil {
+			t.Errorf("Applying %v to `%v` failed: %v", test.patch, test.src, err)
+			continue
+		}
+		if string(res) != test.final {
+			t.Errorf("Applying %v to `%v` gave `%v`, expected `%v`", test.patch, test.src, string(res), test.final)
+		}
+	}
+}
+
+func TestSplicedErrors(t *testing.T) {
+	src := []byte(`{"a": [1, 2]}`)
+	patch, _ := NewPatch([]byte(`[{"op":"add","path":"/b","value":1},{"op":"remove","path":"/a/2"}]`))
+	res, err, loc := patch.ApplyWithOptions(src, ApplyOptions{PreserveBytes: true})
+	if _, ok := err.(*IndexOutOfRangeError); !ok || loc != 1 || res != nil {
+		t.Errorf("Expected an IndexOutOfRangeError at 1, got %v at %d with %s", err, loc, res)
+	}
+	if string(src) != `{"a": [1, 2]}` {
+		t.Errorf("Failed patch changed its input to %s", src)
+	}
+}
+
+func TestSplicedMatchesApply(t *testing.T) {
+	checkMatchesApply(t, "Splicing", func(patch Patch, base interface{}) (interface{}, error, int) {
+		src, _ := json.MarshalIndent(base, "", " ")
+		res, err, loc := patch.ApplyWithOptions(src, ApplyOptions{PreserveBytes: true})
+		if err != nil {
+			return nil, err, loc
+		}
+		var got interface{}
+		return got, utils.Unmarshal(res, &got), loc
+	})
+}
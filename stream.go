@@ -0,0 +1,360 @@
+package jsonpatch2
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// streamOp is an op along with its index in the patch being streamed.
+type streamOp struct {
+	op  Operation
+	idx int
+}
+
+func (s streamOp) pointers() []Pointer {
+	if s.op.Op == "move" || s.op.Op == "copy" {
+		return []Pointer{s.op.path, s.op.from}
+	}
+	return []Pointer{s.op.path}
+}
+
+// streamer applies a patch while copying a document from dec to out.
+type streamer struct {
+	dec *json.Decoder
+	out *bufio.Writer
+}
+
+func (s *streamer) write(str string) {
+	s.out.WriteString(str)
+}
+
+func (s *streamer) writeValue(v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.out.Write(buf)
+	return nil
+}
+
+// copyValue copies the next value from dec to out a token at a time.
+func (s *streamer) copyValue() error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	return s.copyToken(tok)
+}
+
+func (s *streamer) copyToken(tok json.Token) error {
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return s.writeValue(tok)
+	}
+	s.write(delim.String())
+	for first := true; s.dec.More(); first = false {
+		if !first {
+			s.write(",")
+		}
+		if delim == '{' {
+			key, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			if err = s.writeValue(key); err != nil {
+				return err
+			}
+			s.write(":")
+		}
+		if err := s.copyValue(); err != nil {
+			return err
+		}
+	}
+	end, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	s.write(end.(json.Delim).String())
+	return nil
+}
+
+// applyOps applies ops to doc, which is the value at base.
+func applyOps(doc interface{}, base Pointer, ops []streamOp) (interface{}, error) {
+	for _, s := range ops {
+		op := s.op
+		op.path = op.path[len(base):]
+		op.Path = op.path.String()
+		if op.from != nil {
+			op.from = op.from[len(base):]
+			op.From = op.from.String()
+		}
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			if pe, ok := err.(patchError); ok {
+				c := pe.context()
+				c.Path = s.op.path
+				c.Resolved = append(append(Pointer{}, base...), c.Resolved...)
+			}
+			return doc, withOp(err, s.op, s.idx)
+		}
+	}
+	return doc, nil
+}
+
+// buffered reads the next value into memory and applies ops to it.
+func (s *streamer) buffered(path Pointer, ops []streamOp) error {
+	var doc interface{}
+	if err := s.dec.Decode(&doc); err != nil {
+		return err
+	}
+	res, err := applyOps(doc, path, ops)
+	if err != nil {
+		return err
+	}
+	return s.writeValue(res)
+}
+
+// value copies the next value, which is at path, to out while
+// applying ops.  Every pointer in ops must be inside path.
+func (s *streamer) value(path Pointer, ops []streamOp) error {
+	if len(ops) == 0 {
+		return s.copyValue()
+	}
+	for _, op := range ops {
+		ptrs := op.pointers()
+		for _, p := range ptrs {
+			if len(p) == len(path) {
+				return s.buffered(path, ops)
+			}
+		}
+		if len(ptrs) == 2 && ptrs[0][len(path)] != ptrs[1][len(path)] {
+			// The op moves something between two children of path.
+			if len(path) == 0 {
+				return withOp(&InvalidOpError{ErrorContext{Path: op.op.path},
+					fmt.Sprintf("Cannot stream a %v from %v to %v without reading the whole document", op.op.Op, op.op.from, op.op.path)}, op.op, op.idx)
+			}
+			return s.buffered(path, ops)
+		}
+	}
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		return s.object(path, ops)
+	case json.Delim('['):
+		return s.array(path, ops)
+	}
+	// ops go deeper than a scalar, which will make them fail.
+	res, err := applyOps(tok, path, ops)
+	if err != nil {
+		return err
+	}
+	return s.writeValue(res)
+}
+
+// member writes key and val as an object member.
+func (s *streamer) member(first bool, key string, val interface{}) error {
+	if !first {
+		s.write(",")
+	}
+	if err := s.writeValue(key); err != nil {
+		return err
+	}
+	s.write(":")
+	return s.writeValue(val)
+}
+
+// object copies an object at path whose opening brace has been read.
+// Members that ops add, remove, or otherwise point at directly are
+// buffered by themselves, and other members with ops are streamed.
+func (s *streamer) object(path Pointer, ops []streamOp) error {
+	groups := map[string][]streamOp{}
+	direct := map[string]bool{}
+	order := []string{}
+	for _, op := range ops {
+		key := string(op.op.path[len(path)])
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], op)
+		for _, p := range op.pointers() {
+			if len(p) == len(path)+1 {
+				direct[key] = true
+			}
+		}
+	}
+	s.write("{")
+	first := true
+	seen := map[string]bool{}
+	for s.dec.More() {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		seen[key] = true
+		group := groups[key]
+		if direct[key] {
+			var val interface{}
+			if err := s.dec.Decode(&val); err != nil {
+				return err
+			}
+			res, err := applyOps(map[string]interface{}{key: val}, path, group)
+			if err != nil {
+				return err
+			}
+			if val, ok := res.(map[string]interface{})[key]; ok {
+				if err := s.member(first, key, val); err != nil {
+					return err
+				}
+				first = false
+			}
+			continue
+		}
+		if !first {
+			s.write(",")
+		}
+		first = false
+		if err := s.writeValue(key); err != nil {
+			return err
+		}
+		s.write(":")
+		if err := s.value(path.Append(key), group); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	// Members the ops refer to that were not in the object.
+	for _, key := range order {
+		if seen[key] {
+			continue
+		}
+		res, err := applyOps(map[string]interface{}{}, path, groups[key])
+		if err != nil {
+			return err
+		}
+		if val, ok := res.(map[string]interface{})[key]; ok {
+			if err := s.member(first, key, val); err != nil {
+				return err
+			}
+			first = false
+		}
+	}
+	s.write("}")
+	return nil
+}
+
+// array copies an array at path whose opening bracket has been read.
+// Appends and ops inside elements are streamed, but anything that
+// adds or removes elements elsewhere means the array has to be read
+// into memory first.
+func (s *streamer) array(path Pointer, ops []streamOp) error {
+	var appends []streamOp
+	elems := map[int][]streamOp{}
+	whole := false
+	for _, op := range ops {
+		seg := op.op.path[len(path)]
+		direct := len(op.op.path) == len(path)+1
+		if seg == "-" && direct && op.op.Op == "add" {
+			appends = append(appends, op)
+			continue
+		}
+		i, ok := segIndex(seg)
+		if !ok || (direct && op.op.Op != "test" && op.op.Op != "replace") ||
+			(op.op.from != nil && len(op.op.from) == len(path)+1) {
+			whole = true
+			break
+		}
+		elems[i] = append(elems[i], op)
+	}
+	if whole || (len(appends) > 0 && len(elems) > 0) {
+		doc := []interface{}{}
+		for s.dec.More() {
+			var val interface{}
+			if err := s.dec.Decode(&val); err != nil {
+				return err
+			}
+			doc = append(doc, val)
+		}
+		if _, err := s.dec.Token(); err != nil {
+			return err
+		}
+		res, err := applyOps(doc, path, ops)
+		if err != nil {
+			return err
+		}
+		return s.writeValue(res)
+	}
+	s.write("[")
+	i := 0
+	for ; s.dec.More(); i++ {
+		if i > 0 {
+			s.write(",")
+		}
+		if err := s.value(path.Append(strconv.Itoa(i)), elems[i]); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if j, ok := segIndex(op.op.path[len(path)]); ok && j >= i {
+			return withOp(&IndexOutOfRangeError{newContext(op.op.path, len(path)), i}, op.op, op.idx)
+		}
+	}
+	for _, op := range appends {
+		if i > 0 {
+			s.write(",")
+		}
+		i++
+		if err := s.writeValue(op.op.Value); err != nil {
+			return err
+		}
+	}
+	s.write("]")
+	return nil
+}
+
+// ApplyStream applies p to the JSON document read from r, writing the
+// result to w, without reading the whole document into memory.  Only
+// the values that ops point at directly are read into memory, along
+// with arrays that have elements added or removed anywhere but the
+// end.  Move and copy ops between different members of the top level
+// of the document would need all of it, so they return an
+// InvalidOpError instead.
+//
+// Since the result is written as the document is read, the output
+// is incomplete if err is returned.  If the error came from an op,
+// the returned int is its index.
+func (p Patch) ApplyStream(r io.Reader, w io.Writer) (err error, loc int) {
+	if err = p.fixPointers(); err != nil {
+		return err, 0
+	}
+	ops := make([]streamOp, len(p))
+	for i := range p {
+		ops[i] = streamOp{p[i], i}
+	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	s := &streamer{dec: dec, out: bufio.NewWriter(w)}
+	if err = s.value(make(Pointer, 0), ops); err == nil {
+		if _, tokErr := dec.Token(); tokErr != io.EOF {
+			err = fmt.Errorf("invalid data after top-level JSON value")
+		}
+	}
+	if err != nil {
+		if ctx, ok := err.(patchError); ok && ctx.context().Operation != nil {
+			return err, ctx.context().OpIndex
+		}
+		return err, 0
+	}
+	return s.out.Flush(), 0
+}
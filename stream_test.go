@@ -0,0 +1,98 @@
+package jsonpatch2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+// streamsWhole tests whether err is the error ApplyStream returns for
+// ops that need the whole document, and patch really has such an op:
+// a move or copy between two members of the top level.
+func streamsWhole(patch Patch, err error) bool {
+	var opErr *InvalidOpError
+	if !errors.As(err, &opErr) || !strings.HasPrefix(opErr.Reason, "Cannot stream") {
+		return false
+	}
+	for _, op := range patch {
+		if (op.Op == "move" || op.Op == "copy") && len(op.from) > 0 && len(op.path) > 0 && op.from[0] != op.path[0] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStreamPatches(t *testing.T) {
+	for _, test := range opTests {
+		patch, err := NewPatch([]byte(test.patch))
+		if err != nil {
+			continue
+		}
+		var out bytes.Buffer
+		err, _ = patch.ApplyStream(strings.NewReader(test.src), &out)
+		if streamsWhole(patch, err) {
+			continue
+		}
+		if !test.pass {
+			if err == nil {
+				t.Errorf("%v: expected streamed patch to fail", test.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: streamed patch failed: %v", test.desc, err)
+			continue
+		}
+		var got, want interface{}
+		utils.Unmarshal(out.Bytes(), &got)
+		utils.Unmarshal([]byte(test.final), &want)
+		if !Equal(got, want) {
+			t.Errorf("%v: streaming gave %v, expected %v", test.desc, out.String(), test.final)
+		}
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	src := `{"a":{"b":[1,2,3]},"c":{"d":1}}`
+	for _, test := range []struct {
+		patch string
+		loc   int
+	}{
+		{`[{"op":"replace","path":"/c/d","value":2},{"op":"replace","path":"/a/b/5","value":1}]`, 1},
+		{`[{"op":"replace","path":"/c/e","value":2}]`, 0},
+		{`[{"op":"test","path":"/c/d","value":1},{"op":"test","path":"/a/b/0","value":2}]`, 1},
+		{`[{"op":"remove","path":"/a/b/0/x"}]`, 0},
+		{`[{"op":"move","from":"/a/b","path":"/c/b"}]`, 0},
+	} {
+		patch, _ := NewPatch([]byte(test.patch))
+		var out bytes.Buffer
+		err, loc := patch.ApplyStream(strings.NewReader(src), &out)
+		if err == nil || loc != test.loc {
+			t.Errorf("Expected %v to fail at %d, got %v at %d", test.patch, test.loc, err, loc)
+		}
+	}
+	patch, _ := NewPatch([]byte(`[]`))
+	if err, _ := patch.ApplyStream(strings.NewReader(`{} {}`), &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected trailing data to be rejected")
+	}
+}
+
+func TestStreamMatchesApply(t *testing.T) {
+	checkMatchesApply(t, "Streaming", func(patch Patch, base interface{}) (interface{}, error, int) {
+		src, _ := json.Marshal(base)
+		var out bytes.Buffer
+		err, loc := patch.ApplyStream(bytes.NewReader(src), &out)
+		if streamsWhole(patch, err) {
+			return nil, errSkipRound, loc
+		}
+		if err != nil {
+			return nil, err, loc
+		}
+		var got interface{}
+		return got, utils.Unmarshal(out.Bytes(), &got), loc
+	})
+}
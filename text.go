@@ -0,0 +1,183 @@
+package jsonpatch2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+// nextToken splits the first pointer or op name off of line.  Tokens
+// that would be ambiguous bare are written as JSON strings.
+func nextToken(line string) (tok, rest string, err error) {
+	line = strings.TrimLeftFunc(line, unicode.IsSpace)
+	if line == "" {
+		return "", "", fmt.Errorf("missing pointer")
+	}
+	if line[0] != '"' {
+		end := strings.IndexFunc(line, unicode.IsSpace)
+		if end == -1 {
+			end = len(line)
+		}
+		return line[:end], line[end:], nil
+	}
+	for i := 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			err = json.Unmarshal([]byte(line[:i+1]), &tok)
+			return tok, line[i+1:], err
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string %s", line)
+}
+
+// quoteToken is the inverse of nextToken.
+func quoteToken(tok string) string {
+	if tok == "" || tok[0] == '"' || strings.IndexFunc(tok, unicode.IsSpace) != -1 {
+		buf, _ := json.Marshal(tok)
+		return string(buf)
+	}
+	return tok
+}
+
+// parseLine parses a single op in the text syntax.
+func parseLine(line string) (op Operation, err error) {
+	if op.Op, line, err = nextToken(line); err != nil {
+		return op, err
+	}
+	if op.Op == "move" || op.Op == "copy" {
+		if op.From, line, err = nextToken(line); err != nil {
+			return op, err
+		}
+	}
+	if op.Path, line, err = nextToken(line); err != nil {
+		return op, err
+	}
+	line = strings.TrimSpace(line)
+	switch op.Op {
+	case "test", "replace", "add":
+		if line == "" {
+			return op, fmt.Errorf("%v must have a value", op.Op)
+		}
+		if err = utils.Unmarshal([]byte(line), &op.Value); err != nil {
+			return op, err
+		}
+		op.hasValue = true
+	default:
+		if line != "" {
+			return op, fmt.Errorf("unexpected %q after %v", line, op.Op)
+		}
+	}
+	return op, op.fixPointers()
+}
+
+// NewPatchText parses a patch written one op to a line, as:
+//
+//	test /spec/name "web"
+//	replace /spec/replicas 3
+//	add /spec/labels {"app":"web"}
+//	remove /spec/paused
+//	move /spec/old /spec/new
+//	copy /spec/template /spec/backup
+//
+// The from pointer of move and copy comes first, and values are JSON
+// that runs to the end of the line.  Pointers that are empty, contain
+// whitespace, or start with a double quote are written as JSON
+// strings.  Blank lines and lines starting with # are ignored.
+func NewPatchText(buf []byte) (Patch, error) {
+	res := make(Patch, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	scanner.Buffer(nil, len(buf)+1)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		op, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		res = append(res, op)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, res.check()
+}
+
+// MarshalText writes p in the syntax NewPatchText reads.
+func (p Patch) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, op := range p {
+		buf.WriteString(op.Op)
+		if op.Op == "move" || op.Op == "copy" {
+			buf.WriteString(" " + quoteToken(op.From))
+		}
+		buf.WriteString(" " + quoteToken(op.Path))
+		switch op.Op {
+		case "test", "replace", "add":
+			val, err := json.Marshal(op.Value)
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteByte(' ')
+			buf.Write(val)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON keeps Patch marshalling as a JSON array, since
+// encoding/json would otherwise use MarshalText.
+func (p Patch) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]Operation(p))
+}
+
+// MarshalYAML does the same for YAML encoders like gopkg.in/yaml.v3,
+// which would otherwise also use MarshalText.
+func (p Patch) MarshalYAML() (interface{}, error) {
+	return []Operation(p), nil
+}
+
+// yamlNumbers returns a copy of v with the json.Numbers in it turned
+// into ints and floats, which YAML encoders write as numbers instead
+// of strings.
+func yamlNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			res[k] = yamlNumbers(val)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, val := range t {
+			res[i] = yamlNumbers(val)
+		}
+		return res
+	}
+	return v
+}
+
+// MarshalYAML writes o with the same members as encoding/json does.
+func (o Operation) MarshalYAML() (interface{}, error) {
+	return struct {
+		Op, Path, From string
+		Value          interface{}
+	}{o.Op, o.Path, o.From, yamlNumbers(o.Value)}, nil
+}
@@ -0,0 +1,71 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const textPatch = `# Scale up the deployment.
+test /spec/name "web"
+replace /spec/replicas 3
+
+add /spec/labels {"app": "web", "tier": null}
+remove /spec/paused
+move /spec/old "/spec/new name"
+copy "" /spec/backup
+`
+
+const jsonPatch = `[
+{"op":"test","path":"/spec/name","value":"web"},
+{"op":"replace","path":"/spec/replicas","value":3},
+{"op":"add","path":"/spec/labels","value":{"app":"web","tier":null}},
+{"op":"remove","path":"/spec/paused"},
+{"op":"move","from":"/spec/old","path":"/spec/new name"},
+{"op":"copy","from":"","path":"/spec/backup"}
+]`
+
+func TestNewPatchText(t *testing.T) {
+	patch, err := NewPatchText([]byte(textPatch))
+	if err != nil {
+		t.Fatalf("NewPatchText failed: %v", err)
+	}
+	expected, _ := NewPatch([]byte(jsonPatch))
+	got, _ := json.Marshal(patch)
+	want, _ := json.Marshal(expected)
+	if string(got) != string(want) {
+		t.Errorf("NewPatchText gave %s, expected %s", got, want)
+	}
+	text, err := patch.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText failed: %v", err)
+	}
+	if !strings.HasPrefix(string(text), "test /spec/name \"web\"\nreplace /spec/replicas 3\n") ||
+		!strings.HasSuffix(string(text), "move /spec/old \"/spec/new name\"\ncopy \"\" /spec/backup\n") {
+		t.Errorf("MarshalText gave:\n%s", text)
+	}
+	again, err := NewPatchText(text)
+	if err != nil {
+		t.Fatalf("Reading MarshalText output failed: %v", err)
+	}
+	if buf, _ := json.Marshal(again); string(buf) != string(want) {
+		t.Errorf("MarshalText did not round trip: %s", buf)
+	}
+}
+
+func TestNewPatchTextErrors(t *testing.T) {
+	for _, test := range []struct {
+		src, err string
+	}{
+		{"add /a", "line 1: add must have a value"},
+		{"\nremove /a 1", `line 2: unexpected "1" after remove`},
+		{"move /a", "line 1: missing pointer"},
+		{`copy "/a /b`, `line 1: unterminated string "/a /b`},
+		{"replace a 1", "line 1: Initial character of a non-empty pointer must be `/`"},
+		{"frob /a", "op 0 (frob /a): frob is not a valid JSON Patch operator"},
+	} {
+		if _, err := NewPatchText([]byte(test.src)); err == nil || err.Error() != test.err {
+			t.Errorf("Parsing %q gave error %v, expected %v", test.src, err, test.err)
+		}
+	}
+}
@@ -3,8 +3,10 @@ package utils
 // Holds a couple of useful utilities for JSON handling
 
 import (
+	"bytes"
 	"encoding/json"
-	"reflect"
+	"fmt"
+	"io"
 )
 
 // Clone performs a deep clone of a JSON-ish structure.
@@ -27,41 +29,42 @@ func Clone(val interface{}) interface{} {
 	}
 }
 
+// merge follows the MergePatch pseudocode in section 2 of RFC 7386.
+// It may modify src, and may reuse parts of changes in the result.
 func merge(src, changes interface{}) interface{} {
-	if reflect.TypeOf(src) != reflect.TypeOf(changes) {
+	changesVal, ok := changes.(map[string]interface{})
+	if !ok {
 		return changes
 	}
-	switch srcVal := src.(type) {
-	case map[string]interface{}:
-		changesVal := changes.(map[string]interface{})
-		for k, newVal := range changesVal {
-			if newVal == nil {
-				delete(srcVal, k)
-				continue
-			} else {
-				srcVal[k] = Merge(srcVal[k], newVal)
-			}
+	srcVal, ok := src.(map[string]interface{})
+	if !ok {
+		srcVal = make(map[string]interface{}, len(changesVal))
+	}
+	for k, newVal := range changesVal {
+		if newVal == nil {
+			delete(srcVal, k)
+			continue
 		}
-		return srcVal
-	default:
-		return changes
+		srcVal[k] = merge(srcVal[k], newVal)
 	}
+	return srcVal
 }
 
-// Merge merges changes into src recursively.  The original objects
+// Merge merges changes into src recursively, following the rules for
+// applying a JSON Merge Patch in RFC 7386.  The original objects
 // will be left unchanged.
 func Merge(src, changes interface{}) interface{} {
 	return merge(Clone(src), Clone(changes))
 }
 
 // MergeJSON does the same as Merge, except it accepts and returns
-// byte arrays that
+// byte arrays that contain valid JSON.
 func MergeJSON(src, changes []byte) ([]byte, error) {
 	var srcObj, changesObj, resObj interface{}
-	if err := json.Unmarshal(src, &srcObj); err != nil {
+	if err := Unmarshal(src, &srcObj); err != nil {
 		return nil, err
 	}
-	if err := json.Unmarshal(changes, &changesObj); err != nil {
+	if err := Unmarshal(changes, &changesObj); err != nil {
 		return nil, err
 	}
 	resObj = merge(srcObj, changesObj)
@@ -76,3 +79,18 @@ func Remarshal(src, target interface{}) error {
 	}
 	return json.Unmarshal(r, &target)
 }
+
+// Unmarshal works like json.Unmarshal, except that numbers are
+// decoded as json.Number instead of float64 so that they do not lose
+// precision.
+func Unmarshal(buf []byte, target interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(target); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid data after top-level JSON value")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// These are the test cases from Appendix A of RFC 7386.
+var mergeTests = []struct {
+	src, changes, result string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	// Nulls inside arrays are values, not deletions.
+	{`{}`, `{"a":[{"b":null}]}`, `{"a":[{"b":null}]}`},
+	{`5`, `{"a":{"b":null,"c":1}}`, `{"a":{"c":1}}`},
+}
+
+func TestMergeJSON(t *testing.T) {
+	for _, test := range mergeTests {
+		res, err := MergeJSON([]byte(test.src), []byte(test.changes))
+		if err != nil {
+			t.Errorf("Merging `%v` into `%v` failed: %v", test.changes, test.src, err)
+			continue
+		}
+		var got, want interface{}
+		Unmarshal(res, &got)
+		Unmarshal([]byte(test.result), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Merging `%v` into `%v` gave `%v`, expected `%v`", test.changes, test.src, string(res), test.result)
+		}
+	}
+}
+
+func TestMergeLeavesInputsAlone(t *testing.T) {
+	var src, changes interface{}
+	Unmarshal([]byte(`{"a":{"b":1,"c":2}}`), &src)
+	Unmarshal([]byte(`{"a":{"b":null,"d":{"e":null}}}`), &changes)
+	srcCopy, changesCopy := Clone(src), Clone(changes)
+	Merge(src, changes)
+	if !reflect.DeepEqual(src, srcCopy) || !reflect.DeepEqual(changes, changesCopy) {
+		t.Errorf("Merge modified its inputs: %v, %v", src, changes)
+	}
+}
+
+func TestRemarshal(t *testing.T) {
+	var res map[string]interface{}
+	if err := Remarshal(struct{ A int }{1}, &res); err != nil {
+		t.Fatalf("Remarshal failed: %v", err)
+	}
+	if _, ok := res["A"].(float64); !ok {
+		t.Errorf("Remarshal decoded %#v, expected a float64", res["A"])
+	}
+}
@@ -0,0 +1,460 @@
+package jsonpatch2
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+// jsonField describes a struct field as encoding/json sees it.
+type jsonField struct {
+	name      string
+	index     []int
+	depth     int
+	tagged    bool
+	omitEmpty bool
+	omitZero  bool
+	quoted    bool
+}
+
+var fieldCache sync.Map
+
+// jsonFields returns the fields of t that encoding/json would encode,
+// applying the same rules for embedded structs and name conflicts.
+func jsonFields(t reflect.Type) []jsonField {
+	if res, ok := fieldCache.Load(t); ok {
+		return res.([]jsonField)
+	}
+	all := collectFields(t, nil, 0, map[reflect.Type]bool{})
+	byName := make(map[string][]jsonField)
+	for _, f := range all {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	res := make([]jsonField, 0, len(byName))
+	for _, fields := range byName {
+		// Shallower fields win.  At the same depth, a tagged field
+		// wins, and if that does not settle it all of them are dropped.
+		sort.SliceStable(fields, func(i, j int) bool { return fields[i].depth < fields[j].depth })
+		dominant := fields[:1]
+		for _, f := range fields[1:] {
+			if f.depth == fields[0].depth {
+				dominant = append(dominant, f)
+			}
+		}
+		if len(dominant) > 1 {
+			tagged := dominant[:0:0]
+			for _, f := range dominant {
+				if f.tagged {
+					tagged = append(tagged, f)
+				}
+			}
+			dominant = tagged
+		}
+		if len(dominant) == 1 {
+			res = append(res, dominant[0])
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i].index, res[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	fieldCache.Store(t, res)
+	return res
+}
+
+func collectFields(t reflect.Type, index []int, depth int, seen map[reflect.Type]bool) []jsonField {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	res := make([]jsonField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.PkgPath != "" && !(f.Anonymous && ft.Kind() == reflect.Struct) {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		fieldIndex := append(append([]int{}, index...), i)
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			res = append(res, collectFields(ft, fieldIndex, depth+1, seen)...)
+			continue
+		}
+		field := jsonField{name: name, index: fieldIndex, depth: depth, tagged: name != ""}
+		if name == "" {
+			field.name = f.Name
+		}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "omitempty":
+				field.omitEmpty = true
+			case "omitzero":
+				field.omitZero = true
+			case "string":
+				switch ft.Kind() {
+				case reflect.Bool, reflect.String,
+					reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+					reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+					reflect.Float32, reflect.Float64:
+					field.quoted = true
+				}
+			}
+		}
+		res = append(res, field)
+	}
+	return res
+}
+
+// structField finds the field in v that encoding/json would use for
+// name.  Exact matches are preferred over case-insensitive ones, like
+// encoding/json does.  Nil embedded struct pointers along the way are
+// allocated if alloc is true.
+func structField(v reflect.Value, name string, alloc bool) (reflect.Value, bool) {
+	var found *jsonField
+	fields := jsonFields(v.Type())
+	for i := range fields {
+		if fields[i].name == name {
+			found = &fields[i]
+			break
+		}
+		if found == nil && strings.EqualFold(fields[i].name, name) {
+			found = &fields[i]
+		}
+	}
+	if found == nil {
+		return reflect.Value{}, false
+	}
+	return fieldByIndex(v, found.index, alloc)
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, except that it
+// does not panic on nil embedded struct pointers.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	zeroerType        = reflect.TypeOf((*interface{ IsZero() bool })(nil)).Elem()
+	numberType        = reflect.TypeOf(json.Number(""))
+)
+
+// formatFloat formats f the same way encoding/json does.
+func formatFloat(f float64, bits int) string {
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b := strconv.AppendFloat(nil, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return string(b)
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isZeroValue reports whether a field tagged with omitzero should be
+// left out.  Like encoding/json, it uses an IsZero method if there is one.
+func isZeroValue(v reflect.Value) bool {
+	t := v.Type()
+	switch {
+	case t.Implements(zeroerType):
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			return true
+		}
+		return v.Interface().(interface{ IsZero() bool }).IsZero()
+	case reflect.PtrTo(t).Implements(zeroerType):
+		if !v.CanAddr() {
+			addr := reflect.New(t).Elem()
+			addr.Set(v)
+			v = addr
+		}
+		return v.Addr().Interface().(interface{ IsZero() bool }).IsZero()
+	}
+	return v.IsZero()
+}
+
+// visit identifies a pointer, map, or slice that is being walked.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// cycles tracks the pointers, maps, and slices that are being walked,
+// so that cyclic values can be reported instead of recursed into
+// forever.
+type cycles map[visit]bool
+
+// enter marks v as being walked, failing the same way encoding/json
+// does if it already is.  The returned visit must be deleted from c
+// once v has been walked.
+func (c cycles) enter(v reflect.Value) (visit, error) {
+	key := visit{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	if c[key] {
+		return key, &json.UnsupportedValueError{Value: v, Str: fmt.Sprintf("encountered a cycle via %s", v.Type())}
+	}
+	c[key] = true
+	return key, nil
+}
+
+// marshaler returns v as a json.Marshaler or encoding.TextMarshaler
+// if encoding/json would use one of those interfaces to encode it.
+func marshaler(v reflect.Value) (interface{}, bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+	t := v.Type()
+	if !t.Implements(marshalerType) && !t.Implements(textMarshalerType) {
+		if !v.CanAddr() {
+			return nil, false
+		}
+		pt := reflect.PtrTo(t)
+		if !pt.Implements(marshalerType) && !pt.Implements(textMarshalerType) {
+			return nil, false
+		}
+		v = v.Addr()
+	}
+	return v.Interface(), true
+}
+
+// fromGo converts a Go value into the same unmarshalled JSON that
+// marshalling and then unmarshalling it with utils.Unmarshal would
+// produce, without going through an intermediate byte array.
+func fromGo(v reflect.Value) (interface{}, error) {
+	return cycles{}.fromGo(v)
+}
+
+func (c cycles) fromGo(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if m, ok := marshaler(v); ok {
+		switch t := m.(type) {
+		case json.Marshaler:
+			buf, err := t.MarshalJSON()
+			if err != nil {
+				return nil, err
+			}
+			var res interface{}
+			err = utils.Unmarshal(buf, &res)
+			return res, err
+		case encoding.TextMarshaler:
+			buf, err := t.MarshalText()
+			return string(buf), err
+		}
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return json.Number(strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return json.Number(strconv.FormatUint(v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, &json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, 64)}
+		}
+		return json.Number(formatFloat(f, v.Type().Bits())), nil
+	case reflect.String:
+		if v.Type() == numberType {
+			return json.Number(v.String()), nil
+		}
+		return v.String(), nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return c.fromGo(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		key, err := c.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c, key)
+		return c.fromGo(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if _, ok := marshaler(reflect.New(v.Type().Elem()).Elem()); !ok {
+				return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+			}
+		}
+		key, err := c.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c, key)
+		fallthrough
+	case reflect.Array:
+		res := make([]interface{}, v.Len())
+		for i := range res {
+			val, err := c.fromGo(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			res[i] = val
+		}
+		return res, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		key, err := c.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		defer delete(c, key)
+		res := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := mapKeyString(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			val, err := c.fromGo(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			res[key] = val
+		}
+		return res, nil
+	case reflect.Struct:
+		res := make(map[string]interface{})
+		for _, f := range jsonFields(v.Type()) {
+			field, ok := fieldByIndex(v, f.index, false)
+			if !ok || (f.omitEmpty && isEmptyValue(field)) || (f.omitZero && isZeroValue(field)) {
+				continue
+			}
+			val, err := c.fromGo(field)
+			if err != nil {
+				return nil, err
+			}
+			if f.quoted {
+				if val, err = quoteValue(field, val); err != nil {
+					return nil, err
+				}
+			}
+			res[f.name] = val
+		}
+		return res, nil
+	default:
+		return nil, &json.UnsupportedTypeError{Type: v.Type()}
+	}
+}
+
+// quoteValue handles fields tagged with the string option, which
+// encoding/json encodes as a JSON string containing the JSON value.
+func quoteValue(field reflect.Value, val interface{}) (interface{}, error) {
+	for field.Kind() == reflect.Ptr {
+		if _, ok := marshaler(field); ok || field.IsNil() {
+			return val, nil
+		}
+		field = field.Elem()
+	}
+	if _, ok := marshaler(field); ok {
+		// encoding/json ignores the option for values that encode
+		// themselves.
+		return val, nil
+	}
+	switch t := val.(type) {
+	case json.Number:
+		return string(t), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case string:
+		buf, err := json.Marshal(t)
+		return string(buf), err
+	}
+	return val, nil
+}
+
+func mapKeyString(k reflect.Value) (string, error) {
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		buf, err := tm.MarshalText()
+		return string(buf), err
+	}
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", &json.UnsupportedTypeError{Type: k.Type()}
+}
@@ -0,0 +1,202 @@
+package jsonpatch2
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictorLowther/jsonpatch2/utils"
+)
+
+type upperString string
+
+func (u upperString) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(string(u))), nil
+}
+
+type customJSON struct {
+	n int
+}
+
+func (c *customJSON) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]int{"custom": c.n})
+}
+
+type level int
+
+func (l level) String() string {
+	return "high"
+}
+
+type valueEmbedded struct {
+	Shared string `json:"shared"`
+	Inner  int
+}
+
+type valueOther struct {
+	Shared string `json:"shared"`
+	Other  bool
+}
+
+type valueSample struct {
+	*valueEmbedded
+	valueOther
+	Name     string              `json:"name"`
+	Omitted  string              `json:"omitted,omitempty"`
+	ZeroInt  int                 `json:"zeroint,omitzero"`
+	ZeroTime time.Time           `json:"zerotime,omitzero"`
+	ZeroPtr  *customJSON         `json:"zeroptr,omitzero"`
+	ZeroArr  [2]int              `json:"zeroarr,omitzero"`
+	Skipped  int                 `json:"-"`
+	Quoted   int64               `json:"quoted,string"`
+	QLevel   level               `json:"qlevel,string"`
+	QTiny    float64             `json:"qtiny,string"`
+	QFlag    bool                `json:"qflag,string"`
+	QName    string              `json:"qname,string"`
+	QUpper   upperString         `json:"qupper,string"`
+	QPtr     *float32            `json:"qptr,string"`
+	Big      uint64              `json:"big"`
+	Small    float32             `json:"small"`
+	Bytes    []byte              `json:"bytes"`
+	Fixed    [2]int              `json:"fixed"`
+	When     time.Time           `json:"when"`
+	Upper    upperString         `json:"upper"`
+	Custom   customJSON          `json:"custom"`
+	CustomP  *customJSON         `json:"customp"`
+	IntKeys  map[int]string      `json:"intkeys"`
+	TextKeys map[upperString]int `json:"textkeys"`
+	Any      interface{}         `json:"any"`
+	Nil      *valueEmbedded      `json:"nil"`
+	hidden   string
+}
+
+func TestFromGo(t *testing.T) {
+	samples := []interface{}{
+		nil,
+		5,
+		"string",
+		[]int{1, 2, 3},
+		map[string]interface{}{"a": []interface{}{1, "b", nil}},
+		valueSample{},
+		valueSample{
+			valueEmbedded: &valueEmbedded{Shared: "dropped", Inner: 3},
+			valueOther:    valueOther{Shared: "dropped", Other: true},
+			Name:          "name",
+			Omitted:       "present",
+			ZeroInt:       3,
+			ZeroArr:       [2]int{0, 1},
+			Skipped:       4,
+			Quoted:        1 << 60,
+			QLevel:        3,
+			QTiny:         0.000001,
+			QFlag:         true,
+			QName:         "a \"name\"",
+			QUpper:        "upper",
+			QPtr:          new(float32),
+			Big:           1<<64 - 1,
+			Small:         0.1,
+			Bytes:         []byte("bytes"),
+			Fixed:         [2]int{1, 2},
+			When:          time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+			Upper:         "upper",
+			Custom:        customJSON{1},
+			CustomP:       &customJSON{2},
+			IntKeys:       map[int]string{1: "one", -2: "minus two"},
+			TextKeys:      map[upperString]int{"key": 1},
+			Any:           []interface{}{1.5, map[string]interface{}{"x": "y"}},
+			hidden:        "hidden",
+		},
+	}
+	for _, sample := range samples {
+		buf, err := json.Marshal(sample)
+		if err != nil {
+			t.Fatalf("Failed to marshal %#v: %v", sample, err)
+		}
+		var want interface{}
+		if err := utils.Unmarshal(buf, &want); err != nil {
+			t.Fatalf("Failed to unmarshal %v: %v", string(buf), err)
+		}
+		got, err := fromGo(reflect.ValueOf(sample))
+		if err != nil {
+			t.Errorf("Failed to convert %#v: %v", sample, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			gotBuf, _ := json.Marshal(got)
+			t.Errorf("Converted %v, expected %v", string(gotBuf), string(buf))
+		}
+	}
+	if _, err := fromGo(reflect.ValueOf(map[string]interface{}{"c": make(chan int)})); err == nil {
+		t.Errorf("Expected converting a channel to fail")
+	}
+}
+
+type valueNode struct {
+	Name string
+	Next *valueNode
+}
+
+func cyclicValues() []interface{} {
+	node := &valueNode{Name: "a"}
+	node.Next = &valueNode{Name: "b", Next: node}
+	m := map[string]interface{}{}
+	m["m"] = m
+	s := []interface{}{1}
+	s[0] = s
+	return []interface{}{node, m, s}
+}
+
+func TestFromGoCycles(t *testing.T) {
+	for _, v := range cyclicValues() {
+		_, jsonErr := json.Marshal(v)
+		_, err := GenerateFromValues(v, v, GenerateOptions{})
+		if _, ok := err.(*json.UnsupportedValueError); !ok || jsonErr == nil || err.Error() != jsonErr.Error() {
+			t.Errorf("Expected %v from a cyclic %T, got %v", jsonErr, v, err)
+		}
+	}
+	// Values that are shared without being cyclic are fine.
+	shared := &valueNode{Name: "shared"}
+	if _, err := fromGo(reflect.ValueOf([]*valueNode{shared, shared})); err != nil {
+		t.Errorf("Converting a shared pointer failed: %v", err)
+	}
+}
+
+func TestGenerateFromValues(t *testing.T) {
+	base := applyToOuter{Inner: applyToInner{Name: "a", Tags: []string{"x", "y"}}, Counts: map[string]int{"k": 1}}
+	target := base
+	target.Inner = applyToInner{Name: "b", Tags: []string{"y", "z"}}
+	target.Counts = map[string]int{"j": 2}
+	target.ID = 7
+	patch, err := GenerateFromValues(base, &target, GenerateOptions{Paranoid: true})
+	if err != nil {
+		t.Fatalf("Failed to generate patch: %v", err)
+	}
+	res := base
+	if _, err, idx := patch.ApplyTo(&res); err != nil {
+		t.Fatalf("Failed to apply generated patch at %d: %v", idx, err)
+	}
+	if !reflect.DeepEqual(res, target) {
+		t.Errorf("Generated patch turned %#v into %#v, not %#v", base, res, target)
+	}
+	baseBuf, _ := json.Marshal(base)
+	targetBuf, _ := json.Marshal(target)
+	fromBytes, _ := Generate(baseBuf, targetBuf, true)
+	// Object members come out in no particular order, so compare the
+	// ops as a set.
+	if got, want := sortedOps(patch), sortedOps(fromBytes); !reflect.DeepEqual(got, want) {
+		t.Errorf("GenerateFromValues made %v, Generate made %v", got, want)
+	}
+}
+
+func sortedOps(p Patch) []string {
+	res := make([]string, len(p))
+	for i := range p {
+		buf, _ := json.Marshal(p[i])
+		res[i] = string(buf)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,320 @@
+// Package yaml applies and generates JSON Patches for YAML documents,
+// and reads patches written as YAML.
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/VictorLowther/jsonpatch2"
+	"gopkg.in/yaml.v3"
+)
+
+// maxAliasNodes is the most nodes that expanding the aliases in a
+// document may produce, which keeps small documents that alias
+// aliases over and over from expanding into huge values.
+const maxAliasNodes = 1000000
+
+// expander tracks the aliases being expanded while converting nodes.
+type expander struct {
+	// active holds the anchored nodes currently being expanded.
+	active map[*yaml.Node]bool
+	// nodes counts the nodes produced by expanding aliases.
+	nodes int
+}
+
+// fromYAML converts n into the same sort of value utils.Unmarshal
+// produces.  Keys of mappings must be strings, and scalars that are
+// neither null, booleans, nor numbers become strings.
+func fromYAML(n *yaml.Node, ptr jsonpatch.Pointer) (interface{}, error) {
+	return (&expander{active: map[*yaml.Node]bool{}}).fromYAML(n, ptr)
+}
+
+func (e *expander) fromYAML(n *yaml.Node, ptr jsonpatch.Pointer) (interface{}, error) {
+	if len(e.active) > 0 {
+		if e.nodes++; e.nodes > maxAliasNodes {
+			return nil, fmt.Errorf("YAML aliases expand to more than %d values at %v (line %d)", maxAliasNodes, ptr, n.Line)
+		}
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return e.fromYAML(n.Content[0], ptr)
+	case yaml.AliasNode:
+		if e.active[n.Alias] {
+			return nil, fmt.Errorf("YAML alias *%s at %v (line %d) refers to itself", n.Value, ptr, n.Line)
+		}
+		e.active[n.Alias] = true
+		defer delete(e.active, n.Alias)
+		return e.fromYAML(n.Alias, ptr)
+	case yaml.MappingNode:
+		res := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i < len(n.Content); i += 2 {
+			key := n.Content[i]
+			if key.Kind != yaml.ScalarNode || key.ShortTag() != "!!str" {
+				return nil, fmt.Errorf("YAML key %q at %v (line %d) is not a string", key.Value, ptr, key.Line)
+			}
+			val, err := e.fromYAML(n.Content[i+1], ptr.Append(key.Value))
+			if err != nil {
+				return nil, err
+			}
+			res[key.Value] = val
+		}
+		return res, nil
+	case yaml.SequenceNode:
+		res := make([]interface{}, len(n.Content))
+		for i := range n.Content {
+			val, err := e.fromYAML(n.Content[i], ptr.Append(strconv.Itoa(i)))
+			if err != nil {
+				return nil, err
+			}
+			res[i] = val
+		}
+		return res, nil
+	}
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return b, err
+	case "!!int", "!!float":
+		// Keep numbers that are already valid JSON as written.
+		if strings.Trim(n.Value, "0123456789-+.eE") == "" && json.Valid([]byte(n.Value)) {
+			return json.Number(n.Value), nil
+		}
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, err
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("YAML value %q at %v (line %d) cannot be represented in JSON", n.Value, ptr, n.Line)
+		}
+		if n.ShortTag() == "!!int" {
+			var i interface{}
+			if err := n.Decode(&i); err != nil {
+				return nil, err
+			}
+			return json.Number(fmt.Sprint(i)), nil
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	}
+	return n.Value, nil
+}
+
+// decodeYAML reads the single YAML document in buf.
+func decodeYAML(buf []byte) (*yaml.Node, interface{}, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	doc := &yaml.Node{}
+	if err := dec.Decode(doc); err != nil {
+		if err != io.EOF {
+			return nil, nil, err
+		}
+		doc = &yaml.Node{Kind: yaml.DocumentNode}
+	} else if err := dec.Decode(&yaml.Node{}); err != io.EOF {
+		if err == nil {
+			err = fmt.Errorf("multiple YAML documents are not supported")
+		}
+		return nil, nil, err
+	}
+	val, err := fromYAML(doc, make(jsonpatch.Pointer, 0))
+	return doc, val, err
+}
+
+// scalarNode returns a node for a value that is not an object or array.
+func scalarNode(v interface{}) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.ScalarNode}
+	switch t := v.(type) {
+	case nil:
+		n.Tag, n.Value = "!!null", "null"
+	case bool:
+		n.Tag, n.Value = "!!bool", strconv.FormatBool(t)
+	case json.Number:
+		n.Tag, n.Value = "!!int", string(t)
+		if strings.ContainsAny(string(t), ".eE") {
+			n.Tag = "!!float"
+		}
+	case float64:
+		n.Tag, n.Value = "!!float", strconv.FormatFloat(t, 'g', -1, 64)
+	case string:
+		n.Tag, n.Value = "!!str", t
+		// YAML 1.1 parsers would read these as booleans.
+		switch strings.ToLower(t) {
+		case "y", "yes", "n", "no", "on", "off":
+			n.Style = yaml.DoubleQuotedStyle
+		}
+	default:
+		n.Tag, n.Value = "!!str", fmt.Sprint(t)
+	}
+	return n
+}
+
+// toYAML returns a node for v, reusing the parts of old that v did not
+// change so that their comments, styles, and anchors survive.  old may
+// be nil.
+func toYAML(old *yaml.Node, v interface{}) *yaml.Node {
+	if old != nil {
+		if val, err := fromYAML(old, nil); err == nil && jsonpatch.Equal(val, v) {
+			return old
+		}
+		if old.Kind == yaml.AliasNode {
+			old = nil
+		}
+	}
+	var res *yaml.Node
+	switch t := v.(type) {
+	case map[string]interface{}:
+		res = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		done := map[string]bool{}
+		if old != nil && old.Kind == yaml.MappingNode {
+			res.Style = old.Style
+			for i := 0; i < len(old.Content); i += 2 {
+				key := old.Content[i]
+				if val, ok := t[key.Value]; ok && !done[key.Value] {
+					done[key.Value] = true
+					res.Content = append(res.Content, key, toYAML(old.Content[i+1], val))
+				}
+			}
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			if !done[k] {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			res.Content = append(res.Content, scalarNode(k), toYAML(nil, t[k]))
+		}
+	case []interface{}:
+		res = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		var oldElems []*yaml.Node
+		if old != nil && old.Kind == yaml.SequenceNode {
+			res.Style = old.Style
+			oldElems = old.Content
+		}
+		sameLen := len(oldElems) == len(t)
+		next := 0
+		for i, elem := range t {
+			if sameLen {
+				res.Content = append(res.Content, toYAML(oldElems[i], elem))
+				continue
+			}
+			// Elements were added or removed, so reuse the next old
+			// element that is unchanged, if there is one.
+			var match *yaml.Node
+			for j := next; j < len(oldElems); j++ {
+				if val, err := fromYAML(oldElems[j], nil); err == nil && jsonpatch.Equal(val, elem) {
+					match, next = oldElems[j], j+1
+					break
+				}
+			}
+			res.Content = append(res.Content, toYAML(match, elem))
+		}
+	default:
+		res = scalarNode(v)
+	}
+	if old != nil && old.Kind == res.Kind {
+		res.HeadComment, res.LineComment, res.FootComment = old.HeadComment, old.LineComment, old.FootComment
+	}
+	return res
+}
+
+// fixAliases replaces the aliases in n whose anchors were changed or
+// removed, and so are not in seen, with copies of what they referred to.
+func fixAliases(n *yaml.Node, seen map[*yaml.Node]bool) error {
+	if n.Anchor != "" {
+		seen[n] = true
+	}
+	for i, c := range n.Content {
+		if c.Kind == yaml.AliasNode && !seen[c.Alias] {
+			val, err := fromYAML(c, nil)
+			if err != nil {
+				return err
+			}
+			c = toYAML(nil, val)
+			n.Content[i] = c
+		}
+		if err := fixAliases(c, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeYAML writes v as YAML, reusing what it can from doc.
+func encodeYAML(doc *yaml.Node, v interface{}) ([]byte, error) {
+	var old *yaml.Node
+	if len(doc.Content) > 0 {
+		old = doc.Content[0]
+	}
+	res := *doc
+	res.Content = []*yaml.Node{toYAML(old, v)}
+	if err := fixAliases(&res, map[*yaml.Node]bool{}); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&res); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Apply is Patch.Apply for a YAML document.  base is decoded into
+// the same values a JSON document would be, and must not use keys
+// that are not strings (including merge keys).  The result is YAML
+// that keeps the comments and styles of the parts of base the patch
+// did not change, and the comments on scalars it replaced.
+func Apply(p jsonpatch.Patch, base []byte) (result []byte, err error, loc int) {
+	doc, rawBase, err := decodeYAML(base)
+	if err != nil {
+		return nil, err, 0
+	}
+	rawRes, err, loc := p.ApplyDocument(rawBase, jsonpatch.ApplyOptions{})
+	if err != nil {
+		return nil, err, loc
+	}
+	result, err = encodeYAML(doc, rawRes)
+	return result, err, loc
+}
+
+// Generate is jsonpatch.GenerateWithOptions for YAML documents, which
+// are decoded the same way Apply decodes them.
+func Generate(base, target []byte, opts jsonpatch.GenerateOptions) (jsonpatch.Patch, error) {
+	_, rawBase, err := decodeYAML(base)
+	if err != nil {
+		return nil, err
+	}
+	_, rawTarget, err := decodeYAML(target)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.GenerateFromValues(rawBase, rawTarget, opts)
+}
+
+// NewPatch is jsonpatch.NewPatch for a patch written as YAML.
+func NewPatch(buf []byte) (jsonpatch.Patch, error) {
+	_, raw, err := decodeYAML(buf)
+	if err != nil {
+		return nil, err
+	}
+	buf, err = json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.NewPatch(buf)
+}
@@ -0,0 +1,196 @@
+package yaml
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	jsonpatch "github.com/VictorLowther/jsonpatch2"
+	"gopkg.in/yaml.v3"
+)
+
+var yamlTests = []struct {
+	src, patch, final string
+}{
+	{
+		"# The app\nkind: Deployment\nspec:\n  replicas: 1 # scale me\n  name: web\n",
+		`[{"op":"replace","path":"/spec/replicas","value":3}]`,
+		"# The app\nkind: Deployment\nspec:\n  replicas: 3 # scale me\n  name: web\n",
+	},
+	{
+		"b: 1\na: [1, 2]\n",
+		`[{"op":"add","path":"/a/-","value":"3"},{"op":"add","path":"/c","value":{"y":true,"x":null}}]`,
+		"b: 1\na: [1, 2, \"3\"]\nc:\n  x: null\n  \"y\": true\n",
+	},
+	{
+		"items:\n  - name: a # first\n  - name: b # second\n  - name: c # third\n",
+		`[{"op":"remove","path":"/items/1"}]`,
+		"items:\n  - name: a # first\n  - name: c # third\n",
+	},
+	{
+		"base: &b\n  x: 1\nother: *b\n",
+		`[{"op":"add","path":"/base/y","value":"yes"}]`,
+		"base:\n  x: 1\n  \"y\": \"yes\"\nother:\n  x: 1\n",
+	},
+	{
+		"base: &b\n  x: 1\nother: *b\n",
+		`[{"op":"add","path":"/other/y","value":"no"}]`,
+		"base: &b\n  x: 1\nother:\n  x: 1\n  \"y\": \"no\"\n",
+	},
+	{
+		"base: &b\n  x: 1\nother: [*b, *b]\n",
+		`[{"op":"remove","path":"/base"},{"op":"replace","path":"/other/0/x","value":2}]`,
+		"other: [{x: 2}, {x: 1}]\n",
+	},
+	{
+		"",
+		`[{"op":"replace","path":"","value":{"a":"true"}}]`,
+		"a: \"true\"\n",
+	},
+}
+
+func TestYAMLPatches(t *testing.T) {
+	for _, test := range yamlTests {
+		patch, err := jsonpatch.NewPatch([]byte(test.patch))
+		if err != nil {
+			t.Fatalf("Bad patch %v: %v", test.patch, err)
+		}
+		res, err, _ := Apply(patch, []byte(test.src))
+		if err != nil {
+			t.Errorf("Applying %v to %q failed: %v", test.patch, test.src, err)
+			continue
+		}
+		if string(res) != test.final {
+			t.Errorf("Applying %v to %q gave %q, expected %q", test.patch, test.src, string(res), test.final)
+		}
+	}
+}
+
+func TestYAMLErrors(t *testing.T) {
+	patch, _ := jsonpatch.NewPatch([]byte(`[{"op":"test","path":"/a","value":1}]`))
+	for _, src := range []string{
+		"1: a\n",
+		"a: {[1]: 2}\n",
+		"a: .nan\n",
+		"a: 1\n---\na: 2\n",
+		"a: [1\n",
+	} {
+		if _, err, _ := Apply(patch, []byte(src)); err == nil {
+			t.Errorf("Applying to %q should have failed", src)
+		}
+	}
+	if _, err, loc := Apply(patch, []byte("a: 2\n")); err == nil || loc != 0 {
+		t.Errorf("Expected the test op to fail, got %v at %d", err, loc)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	base := "a: 0x10\nb: [1, 2.50]\nc: yes\nd: 2001-12-14\n"
+	target := "a: 16\nb:\n  - 1\n  - 2.5\n  - 3\nc: \"yes\"\nd: \"2001-12-14\"\n"
+	patch, err := Generate([]byte(base), []byte(target), jsonpatch.GenerateOptions{})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	buf, _ := json.Marshal(patch)
+	if string(buf) != `[{"op":"add","path":"/b/-","from":"","value":3}]` {
+		t.Errorf("Generate gave %s", buf)
+	}
+	res, err, _ := Apply(patch, []byte(base))
+	if err != nil || string(res) != "a: 0x10\nb: [1, 2.50, 3]\nc: yes\nd: 2001-12-14\n" {
+		t.Errorf("Applying the generated patch gave %q (%v)", string(res), err)
+	}
+}
+
+func TestYAMLAliasLimits(t *testing.T) {
+	laughs := "a: &a [x, x, x, x, x, x, x, x, x, x]\n"
+	for i := 'b'; i <= 'j'; i++ {
+		laughs += string(i) + ": &" + string(i) + " [" + strings.Repeat("*"+string(i-1)+", ", 9) + "*" + string(i-1) + "]\n"
+	}
+	patch, _ := jsonpatch.NewPatch([]byte(`[]`))
+	for _, src := range []string{
+		"a: &a [*a]\n",
+		"a: &a {b: [1, {c: *a}]}\n",
+		laughs,
+	} {
+		if _, err, _ := Apply(patch, []byte(src)); err == nil {
+			t.Errorf("Applying to %q should have failed", src)
+		}
+		if _, err := Generate([]byte(src), []byte("{}"), jsonpatch.GenerateOptions{}); err == nil {
+			t.Errorf("Generating from %q should have failed", src)
+		}
+		if _, err := NewPatch([]byte(src)); err == nil {
+			t.Errorf("Reading a patch from %q should have failed", src)
+		}
+	}
+}
+
+func TestNewPatch(t *testing.T) {
+	patch, err := NewPatch([]byte(`
+- {op: test, path: /spec/name, value: web}
+- op: replace
+  path: /spec/replicas
+  value: 3
+- op: add
+  path: /spec/labels
+  value:
+    app: web
+    tier: null
+- {op: remove, path: /spec/paused}
+- {op: move, from: /spec/old, path: /spec/new name}
+- {op: copy, from: "", path: /spec/backup}
+`))
+	if err != nil {
+		t.Fatalf("NewPatch failed: %v", err)
+	}
+	expected, _ := jsonpatch.NewPatch([]byte(`[
+{"op":"test","path":"/spec/name","value":"web"},
+{"op":"replace","path":"/spec/replicas","value":3},
+{"op":"add","path":"/spec/labels","value":{"app":"web","tier":null}},
+{"op":"remove","path":"/spec/paused"},
+{"op":"move","from":"/spec/old","path":"/spec/new name"},
+{"op":"copy","from":"","path":"/spec/backup"}
+]`))
+	got, _ := json.Marshal(patch)
+	want, _ := json.Marshal(expected)
+	if string(got) != string(want) {
+		t.Errorf("NewPatch gave %s, expected %s", got, want)
+	}
+	if _, err := NewPatch([]byte("- {op: add, path: /a}\n")); err == nil {
+		t.Errorf("NewPatch should reject an add without a value")
+	}
+}
+
+func TestMarshalPatch(t *testing.T) {
+	patch, _ := jsonpatch.NewPatch([]byte(`[{"op":"replace","path":"/spec/replicas","value":3},{"op":"add","path":"/spec/labels","value":{"app":"web","ratio":0.5}},{"op":"move","from":"/a","path":"/b"}]`))
+	buf, err := yaml.Marshal(patch)
+	if err != nil {
+		t.Fatalf("Marshalling %v failed: %v", patch, err)
+	}
+	want := `- op: replace
+  path: /spec/replicas
+  from: ""
+  value: 3
+- op: add
+  path: /spec/labels
+  from: ""
+  value:
+    app: web
+    ratio: 0.5
+- op: move
+  path: /b
+  from: /a
+  value: null
+`
+	if string(buf) != want {
+		t.Errorf("Marshalling %v gave:\n%s\nexpected:\n%s", patch, buf, want)
+	}
+	back, err := NewPatch(buf)
+	if err != nil {
+		t.Fatalf("Reading back %s failed: %v", buf, err)
+	}
+	got, _ := json.Marshal(back)
+	orig, _ := json.Marshal(patch)
+	if string(got) != string(orig) {
+		t.Errorf("Marshalled patch read back as %s, expected %s", got, orig)
+	}
+}